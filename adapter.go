@@ -2,20 +2,186 @@ package proteus
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 )
 
+// LimitStyle identifies the syntax a database uses to limit the number of rows returned by a query.
+type LimitStyle int
+
+const (
+	// LimitOffset is LIMIT n OFFSET m, used by MySQL, Sqlite, and Postgres.
+	LimitOffset LimitStyle = iota
+	// OffsetFetch is OFFSET m ROWS FETCH NEXT n ROWS ONLY, used by Oracle and SQL Server.
+	OffsetFetch
+)
+
+type dialect struct {
+	placeholder func(pos int) string
+	quoteOpen   string
+	quoteClose  string
+	maxParams   int
+	arrays      bool
+	limitStyle  LimitStyle
+	rowValues   bool
+}
+
+func (d dialect) Placeholder(pos int) string {
+	return d.placeholder(pos)
+}
+
+func (d dialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, d.quoteOpen, d.quoteClose)
+}
+
+func (d dialect) MaxParams() int {
+	return d.maxParams
+}
+
+func (d dialect) SupportsArrays() bool {
+	return d.arrays
+}
+
+func (d dialect) LimitStyle() LimitStyle {
+	return d.limitStyle
+}
+
+func (d dialect) SupportsRowValues() bool {
+	return d.rowValues
+}
+
+// quoteIdentifier wraps name in the supplied quotes, doubling any closing quotes that are already in name.
+func quoteIdentifier(name string, open string, close string) string {
+	return open + strings.ReplaceAll(name, close, close+close) + close
+}
+
+// MySQL is the ParamAdapter for MySQL and MariaDB. It is adapted to MySQLDialect automatically.
 func MySQL(pos int) string {
 	return "?"
 }
 
+// Sqlite is the ParamAdapter for Sqlite. It is adapted to SqliteDialect automatically.
 func Sqlite(pos int) string {
 	return "?"
 }
 
+// Postgres is the ParamAdapter for Postgres. It is adapted to PostgresDialect automatically.
 func Postgres(pos int) string {
 	return fmt.Sprintf("$%d", pos)
 }
 
+// Oracle is the ParamAdapter for Oracle. It is adapted to OracleDialect automatically.
 func Oracle(pos int) string {
 	return fmt.Sprintf(":%d", pos)
 }
+
+// SQLServer is the ParamAdapter for Microsoft SQL Server. It is adapted to SQLServerDialect automatically.
+func SQLServer(pos int) string {
+	return fmt.Sprintf("@p%d", pos)
+}
+
+var (
+	// MySQLDialect is the Dialect for MySQL and MariaDB.
+	MySQLDialect Dialect = &dialect{
+		placeholder: MySQL,
+		quoteOpen:   "`",
+		quoteClose:  "`",
+		maxParams:   65535,
+		limitStyle:  LimitOffset,
+		rowValues:   true,
+	}
+
+	// SqliteDialect is the Dialect for Sqlite. Versions of Sqlite before 3.32.0 allow 999 parameters in a
+	// statement, so that's the limit that is used.
+	SqliteDialect Dialect = &dialect{
+		placeholder: Sqlite,
+		quoteOpen:   `"`,
+		quoteClose:  `"`,
+		maxParams:   999,
+		limitStyle:  LimitOffset,
+		rowValues:   true,
+	}
+
+	// PostgresDialect is the Dialect for Postgres.
+	PostgresDialect Dialect = &dialect{
+		placeholder: Postgres,
+		quoteOpen:   `"`,
+		quoteClose:  `"`,
+		maxParams:   65535,
+		arrays:      true,
+		limitStyle:  LimitOffset,
+		rowValues:   true,
+	}
+
+	// OracleDialect is the Dialect for Oracle. Oracle allows at most 1000 expressions in an in list, so that's
+	// the limit that is used.
+	OracleDialect Dialect = &dialect{
+		placeholder: Oracle,
+		quoteOpen:   `"`,
+		quoteClose:  `"`,
+		maxParams:   1000,
+		limitStyle:  OffsetFetch,
+	}
+
+	// SQLServerDialect is the Dialect for Microsoft SQL Server.
+	SQLServerDialect Dialect = &dialect{
+		placeholder: SQLServer,
+		quoteOpen:   "[",
+		quoteClose:  "]",
+		maxParams:   2100,
+		limitStyle:  OffsetFetch,
+	}
+)
+
+// builtinDialects finds the Dialect for each of the ParamAdapters provided by Proteus. Functions can't be
+// compared, so they are found by their code pointers.
+var builtinDialects = map[uintptr]Dialect{
+	reflect.ValueOf(MySQL).Pointer():     MySQLDialect,
+	reflect.ValueOf(Sqlite).Pointer():    SqliteDialect,
+	reflect.ValueOf(Postgres).Pointer():  PostgresDialect,
+	reflect.ValueOf(Oracle).Pointer():    OracleDialect,
+	reflect.ValueOf(SQLServer).Pointer(): SQLServerDialect,
+}
+
+// dialectFor returns the Dialect to use for a ParamAdapter. A Dialect passed in with WithDialect comes first. The
+// ParamAdapters provided by Proteus are adapted to their Dialects, and any other ParamAdapter is used as a Dialect
+// that only knows about its placeholders.
+func dialectFor(paramAdapter ParamAdapter, opts options) Dialect {
+	if opts.dialect != nil {
+		return opts.dialect
+	}
+	if d, ok := builtinDialects[reflect.ValueOf(paramAdapter).Pointer()]; ok {
+		return d
+	}
+	return paramAdapter
+}
+
+// Placeholder returns the value returned by the ParamAdapter.
+func (pa ParamAdapter) Placeholder(pos int) string {
+	return pa(pos)
+}
+
+// QuoteIdentifier uses the ANSI SQL double quotes.
+func (pa ParamAdapter) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`, `"`)
+}
+
+// MaxParams returns 0, since the limit isn't known.
+func (pa ParamAdapter) MaxParams() int {
+	return 0
+}
+
+// SupportsArrays returns false.
+func (pa ParamAdapter) SupportsArrays() bool {
+	return false
+}
+
+// LimitStyle returns LimitOffset.
+func (pa ParamAdapter) LimitStyle() LimitStyle {
+	return LimitOffset
+}
+
+// SupportsRowValues returns false.
+func (pa ParamAdapter) SupportsRowValues() bool {
+	return false
+}
@@ -0,0 +1,123 @@
+package proteus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDialects(t *testing.T) {
+	data := []struct {
+		name        string
+		dialect     Dialect
+		placeholder string
+		quoted      string
+		maxParams   int
+		arrays      bool
+		limitStyle  LimitStyle
+		rowValues   bool
+	}{
+		{"mysql", MySQLDialect, "?", "`a``b`", 65535, false, LimitOffset, true},
+		{"sqlite", SqliteDialect, "?", "\"a`b\"", 999, false, LimitOffset, true},
+		{"postgres", PostgresDialect, "$2", "\"a`b\"", 65535, true, LimitOffset, true},
+		{"oracle", OracleDialect, ":2", "\"a`b\"", 1000, false, OffsetFetch, false},
+		{"sql server", SQLServerDialect, "@p2", "[a`b]", 2100, false, OffsetFetch, false},
+		{"param adapter", ParamAdapter(func(pos int) string { return "?" }), "?", "\"a`b\"", 0, false, LimitOffset, false},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			if p := v.dialect.Placeholder(2); p != v.placeholder {
+				t.Errorf("expected placeholder %s, got %s", v.placeholder, p)
+			}
+			if q := v.dialect.QuoteIdentifier("a`b"); q != v.quoted {
+				t.Errorf("expected quoted identifier %s, got %s", v.quoted, q)
+			}
+			if m := v.dialect.MaxParams(); m != v.maxParams {
+				t.Errorf("expected max params %d, got %d", v.maxParams, m)
+			}
+			if a := v.dialect.SupportsArrays(); a != v.arrays {
+				t.Errorf("expected arrays %v, got %v", v.arrays, a)
+			}
+			if l := v.dialect.LimitStyle(); l != v.limitStyle {
+				t.Errorf("expected limit style %v, got %v", v.limitStyle, l)
+			}
+			if r := v.dialect.SupportsRowValues(); r != v.rowValues {
+				t.Errorf("expected row values %v, got %v", v.rowValues, r)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifierEscapes(t *testing.T) {
+	if q := PostgresDialect.QuoteIdentifier(`a"b`); q != `"a""b"` {
+		t.Errorf(`expected "a""b", got %s`, q)
+	}
+	if q := SQLServerDialect.QuoteIdentifier(`a]b`); q != `[a]]b]` {
+		t.Errorf(`expected [a]]b], got %s`, q)
+	}
+}
+
+func TestParamAdapterDialect(t *testing.T) {
+	type s struct {
+		GetF func(e Querier, id string) (int, error) `proq:"select * from foo where id = :id:" prop:"id"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(context.Background(), &sImpl, func(pos int) string { return "%s" })
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	dummyDB := &DummyDB{
+		Queries: []string{"select * from foo where id = %s"},
+		Args:    [][]any{{"1"}},
+	}
+	_, err = sImpl.GetF(dummyDB, "1")
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	var pa ParamAdapter = Postgres
+	if Postgres(1) != "$1" || pa(2) != "$2" {
+		t.Errorf("unexpected placeholders %s, %s", Postgres(1), pa(2))
+	}
+	data := []struct {
+		name string
+		pa   ParamAdapter
+		opts options
+		want Dialect
+	}{
+		{"mysql", MySQL, options{}, MySQLDialect},
+		{"sqlite", Sqlite, options{}, SqliteDialect},
+		{"postgres", pa, options{}, PostgresDialect},
+		{"oracle", Oracle, options{}, OracleDialect},
+		{"sql server", SQLServer, options{}, SQLServerDialect},
+		{"with dialect", MySQL, options{dialect: SQLServerDialect}, SQLServerDialect},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			if got := dialectFor(v.pa, v.opts); got != v.want {
+				t.Errorf("expected %v, got %v", v.want, got)
+			}
+		})
+	}
+	custom := dialectFor(func(pos int) string { return "?" }, options{})
+	if _, ok := custom.(ParamAdapter); !ok {
+		t.Errorf("expected a ParamAdapter, got %T", custom)
+	}
+
+	// the Dialect for a provided ParamAdapter is used when the query is built
+	type s struct {
+		F func(ctx context.Context, e ContextExecutor, table string) (int64, error) `proq:"delete from :#table:" prop:"table" proid:"table=foo"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(context.Background(), &sImpl, SQLServer); err != nil {
+		t.Fatal(err)
+	}
+	re := &recordingExecutor{}
+	if _, err := sImpl.F(context.Background(), re, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if re.Queries[0] != "delete from [foo]" {
+		t.Errorf("expected delete from [foo], got %s", re.Queries[0])
+	}
+}
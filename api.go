@@ -26,10 +26,37 @@ type Wrapper interface {
 
 // ParamAdapter maps to valid positional parameters in a DBMS.
 // For example, MySQL uses ? for every parameter, while Postgres uses $NUM and Oracle uses :NUM
+//
+// The ParamAdapters provided by Proteus (MySQL, Sqlite, Postgres, Oracle, and SQLServer) are adapted to their
+// Dialects automatically. Any other ParamAdapter is a Dialect that only knows about positional parameters; the rest
+// of its methods return generic defaults.
 type ParamAdapter func(pos int) string
 
+// Dialect describes the differences between databases that Proteus needs to know about.
+// MySQLDialect, SqliteDialect, PostgresDialect, OracleDialect, and SQLServerDialect are provided. A Dialect can be
+// supplied with WithDialect in place of the one for the ParamAdapter.
+type Dialect interface {
+	// Placeholder returns the positional parameter for the 1-based position pos.
+	Placeholder(pos int) string
+	// QuoteIdentifier quotes a table or column name.
+	QuoteIdentifier(name string) string
+	// MaxParams returns the maximum number of parameters allowed in a single statement, or 0 if there is no known limit.
+	MaxParams() int
+	// SupportsArrays reports whether a slice can be bound to a single parameter as an array.
+	SupportsArrays() bool
+	// LimitStyle returns the syntax used to limit the number of rows returned by a query.
+	LimitStyle() LimitStyle
+	// SupportsRowValues reports whether row values can be compared, as in (a, b) > (1, 2).
+	SupportsRowValues() bool
+}
+
 // QueryMapper maps from a query name to an actual query
 // It is used to support the proq struct tag, when it contains q:name
+//
+// An Option has a Map method so that it can be passed along with the QueryMappers to ShouldBuild, Build, and
+// NewBuilder. Those functions take the Options out of the list before looking up any queries, so an Option is never
+// called as a QueryMapper. Code that accepts QueryMappers of its own should do the same, or expect an Option to map
+// every name to an empty string.
 type QueryMapper interface {
 	// Maps the supplied name to a query string
 	// returns an empty string if there is no query associated with the supplied name
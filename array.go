@@ -0,0 +1,95 @@
+package proteus
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pgArray binds a slice to a single parameter as a Postgres array, written out in the array literal format, like
+// {1,2,"a"}. A slice of slices is written out as an array with more than one dimension.
+type pgArray struct {
+	val any
+}
+
+// Value returns the array literal for the slice, or nil for a nil slice.
+func (a pgArray) Value() (driver.Value, error) {
+	rv := reflect.ValueOf(a.val)
+	if !rv.IsValid() || (rv.Kind() == reflect.Slice && rv.IsNil()) {
+		return nil, nil
+	}
+	var b strings.Builder
+	if err := writeArray(&b, rv); err != nil {
+		return nil, err
+	}
+	return b.String(), nil
+}
+
+func writeArray(b *strings.Builder, rv reflect.Value) error {
+	b.WriteByte('{')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := writeArrayElem(b, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+// writeArrayElem writes out one element of an array. Strings, bytes, and times are always quoted, so that a value
+// like NULL or one with a comma in it isn't mistaken for something else.
+func writeArrayElem(b *strings.Builder, elem reflect.Value) error {
+	if elem.Kind() == reflect.Interface {
+		elem = elem.Elem()
+	}
+	if !elem.IsValid() {
+		b.WriteString("NULL")
+		return nil
+	}
+	if isExpandedSlice(elem.Type()) || (elem.Kind() == reflect.Array && elem.Type().Elem().Kind() != reflect.Uint8) {
+		return writeArray(b, elem)
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(elem.Interface())
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("NULL")
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		if v {
+			b.WriteString("t")
+		} else {
+			b.WriteString("f")
+		}
+	case []byte:
+		writeQuoted(b, `\x`+hex.EncodeToString(v))
+	case time.Time:
+		writeQuoted(b, v.Format(time.RFC3339Nano))
+	case string:
+		writeQuoted(b, v)
+	}
+	return nil
+}
+
+// writeQuoted writes out s in double quotes, with a backslash in front of any double quote or backslash in it.
+func writeQuoted(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+}
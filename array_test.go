@@ -0,0 +1,41 @@
+package proteus
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestPGArray(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   any
+		want any
+	}{
+		{"nil", []int(nil), nil},
+		{"empty", []int{}, "{}"},
+		{"ints", []int{1, 2, 3}, "{1,2,3}"},
+		{"floats", []float64{1.5, -2}, "{1.5,-2}"},
+		{"bools", []bool{true, false}, "{t,f}"},
+		{"strings", []string{"a", `b "c"`, `d\e`, "NULL", "f,g", ""}, `{"a","b \"c\"","d\\e","NULL","f,g",""}`},
+		{"bytes", [][]byte{{0xde, 0xad}}, `{"\\xdead"}`},
+		{"times", []time.Time{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, `{"2024-01-02T03:04:05Z"}`},
+		{"pointers", []*int{nil, new(int)}, "{NULL,0}"},
+		{"valuers", []sql.NullString{{String: "a", Valid: true}, {}}, `{"a",NULL}`},
+		{"interfaces", []any{1, "a", nil}, `{1,"a",NULL}`},
+		{"nested", [][]int{{1, 2}, {3, 4}}, "{{1,2},{3,4}}"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := pgArray{val: tc.in}.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+	if _, err := (pgArray{val: []struct{}{{}}}).Value(); err == nil {
+		t.Error("expected an error for a slice of structs")
+	}
+}
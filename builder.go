@@ -2,13 +2,18 @@ package proteus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go/scanner"
 	"go/token"
 	"log/slog"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"database/sql/driver"
 
@@ -19,7 +24,7 @@ func buildNameOrderMap(paramOrder string, startPos int) map[string]int {
 	out := map[string]int{}
 	params := strings.Split(paramOrder, ",")
 	for k, v := range params {
-		out[strings.TrimSpace(v)] = k + startPos
+		out[propName(v)] = k + startPos
 	}
 	return out
 }
@@ -45,7 +50,7 @@ func (sq simpleQueryHolder) finalize(ctx context.Context, args []reflect.Value)
 
 type templateQueryHolder struct {
 	queryString string
-	pa          ParamAdapter
+	pa          Dialect
 	paramOrder  []paramInfo
 }
 
@@ -55,106 +60,311 @@ func (tq templateQueryHolder) finalize(ctx context.Context, args []reflect.Value
 
 var (
 	valueType = reflect.TypeFor[driver.Valuer]()
+	timeType  = reflect.TypeFor[time.Time]()
 )
 
 type posType interface {
 	In(i int) reflect.Type
 }
 
-func buildFixedQueryAndParamOrder(ctx context.Context, query string, nameOrderMap map[string]int, funcType posType, pa ParamAdapter) (queryHolder, []paramInfo, error) {
+func buildFixedQueryAndParamOrder(ctx context.Context, query string, nameOrderMap map[string]int, funcType posType, pa Dialect, opts options) (queryHolder, []paramInfo, error) {
 	var out strings.Builder
 
 	var paramOrder []paramInfo
 
-	// escapes:
-	// \ (any character), that character literally (meant for escaping : and \)
-	// ending on a single \ means the \ is ignored
-	inEscape := false
-	inVar := false
-	var curVar strings.Builder
+	if opts.namespace != "" {
+		if err := checkNamespace(funcType, nameOrderMap, opts.namespace); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tokens, lexErr := lexQuery(query, opts.syntax)
 	hasSlice := false
-	for k, v := range query {
-		if inEscape {
-			out.WriteRune(v)
-			inEscape = false
+	hasText := false
+	numbered := isNumbered(pa)
+	seen := map[string]bool{}
+	//text is held until the next variable is processed, in case it needs to be rewritten for array binding
+	var pending string
+	//the ids of the conditional fragments that enclose the current token, outermost first
+	var fragments []int
+	var fragmentStarts []int
+	fragmentHasVars := map[int]bool{}
+	fragmentCount := 0
+	//scopeKey makes sure that a variable in a fragment only shares placeholders with an earlier variable that is
+	//outside of any fragment, or inside the same fragment or one that encloses it. Otherwise, dropping the fragment
+	//with the earlier variable would leave the later one without a value.
+	scopeKey := func(key string) string {
+		if len(fragments) == 0 {
+			return key
+		}
+		fragmentHasVars[fragments[len(fragments)-1]] = true
+		if seen[key] {
+			return key
+		}
+		for _, f := range fragments {
+			if scoped := key + fragmentKey(f); seen[scoped] {
+				return scoped
+			}
+		}
+		return key + fragmentKey(fragments[len(fragments)-1])
+	}
+	//addText writes out an identifier or a Sort, whose value is written into the query text when it is finalized
+	addText := func(info paramInfo) {
+		out.WriteString(escapeTemplateText(pending))
+		pending = ""
+		if len(fragments) > 0 {
+			fragmentHasVars[fragments[len(fragments)-1]] = true
+		}
+		out.WriteString(fmt.Sprintf(identifierTemplate, identifierKey(info.name)))
+		info.fragments = slices.Clone(fragments)
+		hasText = true
+		paramOrder = append(paramOrder, info)
+	}
+	for i, token := range tokens {
+		switch token.kind {
+		case textToken:
+			pending += token.value
+			continue
+		case fragmentStartToken:
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			fragmentCount++
+			fragments = append(fragments, fragmentCount)
+			fragmentStarts = append(fragmentStarts, token.pos)
+			out.WriteString(fmt.Sprintf(fragmentTemplate, fragmentKey(fragmentCount)))
+			continue
+		case fragmentEndToken:
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			if !fragmentHasVars[fragments[len(fragments)-1]] {
+				return nil, nil, QueryError{Kind: EmptyFragment, Query: query, Position: fragmentStarts[len(fragmentStarts)-1]}
+			}
+			fragments = fragments[:len(fragments)-1]
+			fragmentStarts = fragmentStarts[:len(fragmentStarts)-1]
+			out.WriteString("{{end}}")
 			continue
 		}
-		switch v {
-		case '\\':
-			inEscape = true
-		case ':':
-			if inVar {
-				if curVar.Len() == 0 {
-					//error! must have a something
-					return nil, nil, QueryError{Kind: EmptyVariable, Position: k}
+		value, transforms, err := parseTransforms(token.value, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if columns, ok := rowsColumns(value); ok {
+			if len(transforms) > 0 {
+				return nil, nil, QueryError{Kind: TransformNotAllowed, Name: value}
+			}
+			info, err := buildRowsParamInfo(ctx, value, columns, nameOrderMap, funcType, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			key := scopeKey("rows(" + strings.Join(info.columns, ",") + ")")
+			out.WriteString(addRows(info.name, key, len(info.columns)))
+			hasSlice = true
+			info.empty = opts.empty
+			info.fragments = slices.Clone(fragments)
+			if numbered && seen[key] {
+				if len(fragments) == 0 {
+					continue
 				}
-				curVarS := curVar.String()
-				id, err := validIdentifier(ctx, curVarS)
-				if err != nil {
-					//error, identifier must be valid go identifier with . for path
-					return nil, nil, err
+				info.reused = true
+			}
+			seen[key] = true
+			paramOrder = append(paramOrder, info)
+			continue
+		}
+		if name, ok := strings.CutPrefix(value, "#"); ok {
+			if len(transforms) > 0 {
+				return nil, nil, QueryError{Kind: TransformNotAllowed, Name: value}
+			}
+			info, err := buildIdentifierParamInfo(ctx, name, nameOrderMap, funcType, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			addText(info)
+			continue
+		}
+		id, err := validPath(ctx, value)
+		if err != nil {
+			//error, identifier must be valid go identifier with . for path
+			return nil, nil, err
+		}
+		if isContextVariable(id, nameOrderMap) {
+			info, err := buildContextParamInfo(id, funcType, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			key := scopeKey(transformsKey(id, transforms))
+			out.WriteString(addSliceAs(templateKey(info.name, transforms, false), key))
+			info.transforms = transforms
+			info.fragments = slices.Clone(fragments)
+			if numbered && seen[key] {
+				if len(fragments) == 0 {
+					continue
 				}
-				//it's a valid identifier, but now we need to know if it's a slice or a scalar.
-				//all we have is the name, not the mapping of the name to the position in the in parameters for the function.
-				//so we need to do that search now, using the information in the struct tag prop.
-				//mapper.ExtractType can tell us the kind of what we're expecting
-				//if it's a scalar, then we use pa to write out the correct symbol for this db type and increment pos.
-				//if it's a slice, then we put in the slice template syntax instead.
-
-				//get just the first part of the name, before any .
-				path := strings.Split(id, ".")
-				paramName := path[0]
-				if paramPos, ok := nameOrderMap[paramName]; ok {
-					//if the path has more than one part, make sure that the type of the function parameter is map or struct
-					paramType := funcType.In(paramPos)
-					if len(path) > 1 {
-						if paramType == nil {
-							return nil, nil, QueryError{Kind: NilParameterPath, Name: paramName}
-						}
-						switch paramType.Kind() {
-						case reflect.Map, reflect.Struct:
-							//do nothing
-						default:
-							return nil, nil, QueryError{Kind: InvalidParameterType, Name: paramName, TypeKind: paramType.Kind().String()}
-						}
-					}
-					pathType, err := mapper.ExtractType(ctx, paramType, path)
-					if err != nil {
-						return nil, nil, err
-					}
-					out.WriteString(addSlice(id))
-					isSlice := false
-					//special case -- slice of bytes is never expanded out into a comma-separated list
-					if pathType != nil && pathType.Kind() == reflect.Slice && !pathType.Implements(valueType) && pathType.Elem().Kind() != reflect.Uint8 {
-						hasSlice = true
-						isSlice = true
-					}
-					paramOrder = append(paramOrder, paramInfo{id, paramPos, isSlice})
-				} else {
-					return nil, nil, QueryError{Kind: ParameterNotFound, Name: paramName}
+				info.reused = true
+			}
+			seen[key] = true
+			paramOrder = append(paramOrder, info)
+			continue
+		}
+		id = markNilSafe(qualify(id, nameOrderMap, opts.namespace), opts)
+		//it's a valid identifier, but now we need to know if it's a slice or a scalar.
+		//all we have is the name, not the mapping of the name to the position in the in parameters for the function.
+		//so we need to do that search now, using the information in the struct tag prop.
+		//mapper.ExtractType can tell us the kind of what we're expecting
+		//if it's a scalar, then we use pa to write out the correct symbol for this db type and increment pos.
+		//if it's a slice, then we put in the slice template syntax instead.
+		paramPos, pathType, err := resolvePath(ctx, id, nameOrderMap, funcType)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(transforms) > 0 && (pathType == sortType || pathType == cursorType || pathType == filterType || pathType == pageType) {
+			return nil, nil, QueryError{Kind: TransformNotAllowed, Name: id}
+		}
+		if pathType == sortType {
+			info, err := buildSortParamInfo(id, paramPos, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			addText(info)
+			continue
+		}
+		if pathType == cursorType {
+			info, keys, err := buildCursorParamInfo(id, paramPos, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			key := scopeKey(id)
+			var text string
+			text, info.cursorOrder = addCursor(id, key, keys, pa)
+			out.WriteString(text)
+			hasText = true
+			info.fragments = slices.Clone(fragments)
+			if numbered && seen[key] {
+				if len(fragments) == 0 {
+					continue
 				}
-
-				inVar = false
-				curVar.Reset()
-			} else {
-				inVar = true
+				info.reused = true
 			}
-		default:
-			if inVar {
-				curVar.WriteRune(v)
-			} else {
-				out.WriteRune(v)
+			seen[key] = true
+			paramOrder = append(paramOrder, info)
+			continue
+		}
+		if pathType == filterType {
+			info, err := buildFilterParamInfo(id, paramPos, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			key := scopeKey(id)
+			out.WriteString(fmt.Sprintf(filterTemplate, key, identifierKey(id)))
+			hasText = true
+			info.fragments = slices.Clone(fragments)
+			if numbered && seen[key] {
+				if len(fragments) == 0 {
+					continue
+				}
+				info.reused = true
 			}
+			seen[key] = true
+			paramOrder = append(paramOrder, info)
+			continue
 		}
+		if pathType == pageType {
+			out.WriteString(escapeTemplateText(pending))
+			pending = ""
+			key := scopeKey(id)
+			out.WriteString(addPage(id, key, pa.LimitStyle()))
+			//the page is left out of a count query, so it's only written out when the query is finalized
+			hasText = true
+			info := paramInfo{name: id, posInParams: paramPos, page: true, limitStyle: pa.LimitStyle(), fragments: slices.Clone(fragments)}
+			if numbered && seen[key] {
+				if len(fragments) == 0 {
+					continue
+				}
+				info.reused = true
+			}
+			seen[key] = true
+			paramOrder = append(paramOrder, info)
+			continue
+		}
+		//special case -- slice of bytes is never expanded out into a comma-separated list
+		//the type that comes out of a transform isn't known until the query is run, so the value is never expanded
+		isSlice := len(transforms) == 0 && isExpandedSlice(pathType)
+		//the type of a value in an interface, like the values in a map[string]any, isn't known until the query is run
+		runtimeSlice := len(transforms) == 0 && pathType != nil && pathType.Kind() == reflect.Interface && !pathType.Implements(valueType)
+		//the type that comes out of a transform can be anything, so only the value's own type is checked
+		if len(transforms) == 0 {
+			//the pointers are kept, since a Value method with a pointer receiver is only there for a pointer
+			leafType, err := mapper.ExtractDeclaredType(ctx, funcType.In(paramPos), strings.Split(id, "."))
+			if err != nil {
+				return nil, nil, err
+			}
+			if isSlice {
+				leafType = elemType(leafType)
+			}
+			if !isBindable(leafType) {
+				return nil, nil, QueryError{Kind: UnbindableType, Name: id, TypeKind: leafType.String()}
+			}
+		}
+		asArray := false
+		if isSlice && opts.arrays && pa.SupportsArrays() && i+1 < len(tokens) {
+			if rewritten, ok := rewriteInClause(pending, tokens[i+1]); ok {
+				pending = rewritten
+				isSlice = false
+				asArray = true
+			}
+		}
+		notIn := endsWithNotIn(pending)
+		out.WriteString(escapeTemplateText(pending))
+		pending = ""
+		var key string
+		if asArray {
+			//an array is always a single placeholder, so it can't share placeholders with an expanded slice of the same name
+			key = scopeKey(id + "[]")
+			out.WriteString(fmt.Sprintf(arrayTemplate, key))
+		} else {
+			key = scopeKey(transformsKey(id, transforms))
+			out.WriteString(addSliceAs(templateKey(id, transforms, false), key))
+		}
+		info := paramInfo{name: id, posInParams: paramPos, isSlice: isSlice, runtimeSlice: runtimeSlice, asArray: asArray, transforms: transforms, fragments: slices.Clone(fragments)}
+		if isSlice || runtimeSlice {
+			info.empty = opts.empty
+			//an empty not in matches every row, but not in (NULL) matches none, and skipping the query returns none, too
+			if notIn {
+				info.empty = EmptySliceError
+			}
+		}
+		//numbered placeholders can be reused, so the value for a repeated name is only sent once
+		if numbered && seen[key] {
+			if len(fragments) == 0 {
+				continue
+			}
+			//still needed to decide if the fragment is kept
+			info.reused = true
+		}
+		seen[key] = true
+		hasSlice = hasSlice || isSlice || runtimeSlice
+		if info.contextKey == nil {
+			info.defaultValue = opts.defaults[info.posInParams]
+		}
+		paramOrder = append(paramOrder, info)
 	}
-	if inVar {
-		return nil, nil, QueryError{Kind: MissingClosingColon, Query: query}
+	out.WriteString(escapeTemplateText(pending))
+	if lexErr != nil {
+		return nil, nil, lexErr
 	}
 
 	queryString := out.String()
 
-	if !hasSlice {
-		//no slices, so last param is never going to be referenced in doFinalize
+	if !hasSlice && !hasText && fragmentCount == 0 {
+		//no slices, identifiers, sorts, or fragments, so last param is never going to be referenced in doFinalize
 		queryString, err := doFinalize(ctx, queryString, paramOrder, pa, nil)
 		if err != nil {
 			return nil, nil, err
@@ -164,26 +374,83 @@ func buildFixedQueryAndParamOrder(ctx context.Context, query string, nameOrderMa
 	return templateQueryHolder{queryString: queryString, pa: pa, paramOrder: paramOrder}, paramOrder, nil
 }
 
-func doFinalize(ctx context.Context, queryString string, paramOrder []paramInfo, pa ParamAdapter, args []reflect.Value) (string, error) {
-	temp, err := template.New("query").Funcs(template.FuncMap{"join": joinFactory(1, pa)}).Parse(queryString)
+func doFinalize(ctx context.Context, queryString string, paramOrder []paramInfo, pa Dialect, args []reflect.Value) (string, error) {
+	join := joinFactory(1, pa)
+	temp, err := template.New("query").Funcs(template.FuncMap{"join": join, "rows": rowsFactory(join), "filter": filterFactory(join)}).Parse(queryString)
 	if err != nil {
 		return "", err
 	}
 
+	present, err := fragmentsPresent(ctx, args, paramOrder)
+	if err != nil {
+		return "", err
+	}
 	//can evaluate the template now, with 1 for the length for each item
 	sliceMap := map[string]any{}
+	for k, v := range present {
+		sliceMap[fragmentKey(k)] = v
+	}
 	for _, v := range paramOrder {
-		if v.isSlice {
+		if v.reused || !included(v, present) {
+			continue
+		}
+		if v.identifier {
+			var quoted string
+			quoted, err = identifierValue(ctx, args, v, pa)
+			if err != nil {
+				return "", err
+			}
+			sliceMap[identifierKey(v.name)] = quoted
+			continue
+		}
+		if v.page {
+			sliceMap[identifierKey(v.name)] = true
+			continue
+		}
+		if v.cursor {
 			var val any
-			val, err = mapper.Extract(ctx, args[v.posInParams].Interface(), strings.Split(v.name, "."))
+			val, err = extractParam(ctx, args, v)
 			if err != nil {
-				break
+				return "", err
+			}
+			sliceMap[identifierKey(v.name)] = cursorValue(val) != ""
+			continue
+		}
+		if v.filterColumns != nil {
+			var val any
+			val, err = extractParam(ctx, args, v)
+			if err != nil {
+				return "", err
+			}
+			pf := filterValue(val, v)
+			//check the filter here, so that any error is returned as is
+			if _, err = pf.args(); err != nil {
+				return "", err
+			}
+			sliceMap[identifierKey(v.name)] = pf
+			continue
+		}
+		if v.sortColumns != nil {
+			var columns string
+			columns, err = sortValue(ctx, args, v)
+			if err != nil {
+				return "", err
+			}
+			sliceMap[identifierKey(v.name)] = columns
+			continue
+		}
+		if v.isSlice || v.runtimeSlice {
+			var val any
+			val, err = extractParam(ctx, args, v)
+			if err != nil {
+				return "", err
+			}
+			if v.isSlice || isExpandedSlice(reflect.TypeOf(val)) {
+				sliceMap[templateKey(v.name, v.transforms, v.asArray)] = sliceLen(val)
+				continue
 			}
-			valV := reflect.ValueOf(val)
-			sliceMap[fixNameForTemplate(v.name)] = valV.Len()
-		} else {
-			sliceMap[fixNameForTemplate(v.name)] = 1
 		}
+		sliceMap[templateKey(v.name, v.transforms, v.asArray)] = 1
 	}
 	var b strings.Builder
 	err = temp.Execute(&b, sliceMap)
@@ -194,40 +461,441 @@ func doFinalize(ctx context.Context, queryString string, paramOrder []paramInfo,
 }
 
 type paramInfo struct {
-	name        string
-	posInParams int
-	isSlice     bool
+	name          string
+	posInParams   int
+	isSlice       bool
+	runtimeSlice  bool // the type isn't known until the query is run, so the value is expanded if it's a slice
+	asArray       bool
+	empty         EmptySlicePolicy  // only used when isSlice is true
+	columns       []string          // the paths for each element in a batch of rows; name is the slice
+	fragments     []int             // the ids of the conditional fragments that enclose the variable, outermost first
+	reused        bool              // uses the placeholders of an earlier variable, so it has no value of its own
+	identifier    bool              // written into the query as a quoted identifier, rather than bound as a parameter
+	allowed       []string          // the values allowed for an identifier
+	sortColumns   map[string]string // the column expressions for the keys in a Sort; nil for everything else
+	page          bool              // a Page, which has placeholders for its size and offset
+	limitStyle    LimitStyle        // only used when page is true
+	cursor        bool              // a Cursor, which has a placeholder for each value of each key column in its predicate
+	keyNames      []string          // the names of the key columns for a Cursor
+	cursorOrder   []int             // the index of the key column for each placeholder in the predicate for a Cursor
+	filterColumns map[string]string // the column expressions for the fields in a Filter; nil for everything else
+	transforms    []namedTransform  // applied to the value before it is bound
+	contextKey    any               // the key for a value that comes from the context; nil for everything else
+	defaultValue  reflect.Value     // used in place of the parameter when it is nil; invalid if there's no default
+}
+
+// isExpandedSlice reports whether a value of type t is expanded into one placeholder for each element. A []byte or a
+// driver.Valuer is always bound as a single value.
+func isExpandedSlice(t reflect.Type) bool {
+	return t != nil && t.Kind() == reflect.Slice && !t.Implements(valueType) && t.Elem().Kind() != reflect.Uint8
+}
+
+// isBindable reports whether database/sql can bind a value of type t as a parameter: a bool, a number, or a string
+// (including named types), a []byte, a time.Time, a driver.Valuer, or a pointer to any of them. The type of a value
+// in an interface isn't known until the query is run, so it is always allowed. A type whose Value method has a
+// pointer receiver is only a driver.Valuer when it is a pointer.
+func isBindable(t reflect.Type) bool {
+	if t == nil || t.Implements(valueType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return isBindable(t.Elem())
+	case reflect.Bool, reflect.String, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return t == timeType
+	default:
+		return false
+	}
+}
+
+// elemType returns the type of the elements of a slice, or of the slice that a pointer refers to.
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Elem()
+}
+
+// sliceLen returns the number of elements in the value of a slice variable. A nil from a nil-safe path has none.
+func sliceLen(val any) int {
+	rv := reflect.ValueOf(val)
+	if !rv.IsValid() {
+		return 0
+	}
+	return rv.Len()
+}
+
+// resolvePath finds the function parameter for a variable and the type at the end of its path.
+func resolvePath(ctx context.Context, id string, nameOrderMap map[string]int, funcType posType) (int, reflect.Type, error) {
+	//get just the first part of the name, before any .
+	path := strings.Split(id, ".")
+	paramName := trimNilSafe(path[0])
+	paramPos, ok := nameOrderMap[paramName]
+	if !ok {
+		return 0, nil, QueryError{Kind: ParameterNotFound, Name: paramName}
+	}
+	//if the path has more than one part, make sure that the type of the function parameter is map, struct, or
+	//slice (for an index, or a path applied to each element), or a pointer to one of them
+	paramType := funcType.In(paramPos)
+	if len(path) > 1 {
+		if paramType == nil {
+			return 0, nil, QueryError{Kind: NilParameterPath, Name: paramName}
+		}
+		baseType := paramType
+		for baseType.Kind() == reflect.Pointer {
+			baseType = baseType.Elem()
+		}
+		switch baseType.Kind() {
+		case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+			//do nothing
+		default:
+			return 0, nil, QueryError{Kind: InvalidParameterType, Name: paramName, TypeKind: baseType.Kind().String()}
+		}
+	}
+	pathType, err := mapper.ExtractType(ctx, paramType, path)
+	if err != nil {
+		return 0, nil, err
+	}
+	return paramPos, pathType, nil
+}
+
+// buildIdentifierParamInfo validates a dynamic identifier variable. It must resolve to a string, and it must have a
+// list of allowed values.
+func buildIdentifierParamInfo(ctx context.Context, name string, nameOrderMap map[string]int, funcType posType, opts options) (paramInfo, error) {
+	id, err := validIdentifier(ctx, name)
+	if err != nil {
+		return paramInfo{}, err
+	}
+	path := qualify(id, nameOrderMap, opts.namespace)
+	paramPos, pathType, err := resolvePath(ctx, path, nameOrderMap, funcType)
+	if err != nil {
+		return paramInfo{}, err
+	}
+	if pathType != nil && pathType.Kind() != reflect.String && pathType.Kind() != reflect.Interface {
+		return paramInfo{}, QueryError{Kind: InvalidParameterType, Name: id, TypeKind: pathType.Kind().String()}
+	}
+	allowed, ok := opts.identifiers[id]
+	if !ok {
+		return paramInfo{}, QueryError{Kind: NoAllowlist, Name: id}
+	}
+	return paramInfo{name: path, posInParams: paramPos, identifier: true, allowed: allowed}, nil
+}
+
+// identifierValue checks the value of a dynamic identifier against its allowed values and quotes it for the dialect.
+// A value with periods, like a schema-qualified table name, has each part quoted separately.
+func identifierValue(ctx context.Context, args []reflect.Value, v paramInfo, pa Dialect) (string, error) {
+	val, err := extractParam(ctx, args, v)
+	if err != nil {
+		return "", err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(val))
+	if rv.Kind() != reflect.String {
+		return "", QueryError{Kind: InvalidParameterType, Name: v.name, TypeKind: rv.Kind().String()}
+	}
+	name := rv.String()
+	if !slices.Contains(v.allowed, name) {
+		return "", QueryError{Kind: IdentifierNotAllowed, Name: v.name, Value: name}
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pa.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// extractParam returns the value of a variable from the function parameters, or from the context. A nil parameter
+// is replaced with its default, if it has one.
+func extractParam(ctx context.Context, args []reflect.Value, v paramInfo) (any, error) {
+	if v.contextKey != nil {
+		return contextValue(ctx, v)
+	}
+	value := args[v.posInParams]
+	if v.defaultValue.IsValid() && (!value.IsValid() || value.IsNil()) {
+		value = v.defaultValue
+	}
+	var realValue any
+	if value.IsValid() {
+		realValue = value.Interface()
+	}
+	return mapper.Extract(ctx, realValue, strings.Split(v.name, "."))
+}
+
+// fragmentsPresent finds out which conditional fragments are kept in the query. A fragment is kept if every
+// variable directly inside of it has a value: it isn't nil (including a nil pointer, or a Valuer whose value is
+// nil), and it isn't an empty slice, an empty Cursor, or an empty Filter. A value that isn't in the context doesn't
+// have a value, either. A fragment inside of a dropped fragment is dropped, too. Defaults aren't used here, so a
+// fragment is dropped when the caller doesn't provide a value for it.
+func fragmentsPresent(ctx context.Context, args []reflect.Value, paramOrder []paramInfo) (map[int]bool, error) {
+	present := map[int]bool{}
+	for _, v := range paramOrder {
+		if len(v.fragments) == 0 {
+			continue
+		}
+		inner := v.fragments[len(v.fragments)-1]
+		if dropped(v.fragments, present) {
+			continue
+		}
+		v.defaultValue = reflect.Value{}
+		val, err := extractParam(ctx, args, v)
+		if errors.Is(err, QueryError{Kind: MissingContextValue}) {
+			present[inner] = false
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		present[inner] = hasValue(val)
+	}
+	return present, nil
+}
+
+// dropped reports whether any of the fragments is already known to be dropped.
+func dropped(fragments []int, present map[int]bool) bool {
+	for _, f := range fragments {
+		if kept, ok := present[f]; ok && !kept {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether every fragment around a variable is kept.
+func included(v paramInfo, present map[int]bool) bool {
+	for _, f := range v.fragments {
+		if !present[f] {
+			return false
+		}
+	}
+	return true
+}
+
+func hasValue(val any) bool {
+	if val == nil {
+		return false
+	}
+	switch v := val.(type) {
+	case Cursor:
+		return v != ""
+	case *Cursor:
+		return v != nil && *v != ""
+	case Filter:
+		return !v.isEmpty()
+	case *Filter:
+		return v != nil && !v.isEmpty()
+	}
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return !rv.IsNil()
+	case reflect.Slice:
+		return rv.Len() > 0
+	}
+	return true
+}
+
+func fragmentKey(id int) string {
+	return "#" + strconv.Itoa(id)
+}
+
+// identifierKey is the template key for the text written in place of an identifier or a Sort. It never collides with
+// a fragmentKey, since a variable name doesn't start with a digit.
+func identifierKey(name string) string {
+	return "#" + fixNameForTemplate(name)
 }
 
 const (
-	sliceTemplate = `{{.%s | join}}`
+	sliceTemplate      = `{{index . %q | join %q}}`
+	arrayTemplate      = `{{join %q 1}}`
+	rowsTemplate       = `{{.%s | rows %q %d}}`
+	fragmentTemplate   = `{{if index . %q}}`
+	identifierTemplate = `{{index . %q}}`
+	filterTemplate     = `{{filter %q (index . %q)}}`
 )
 
-func joinFactory(startPos int, paramAdapter ParamAdapter) func(int) string {
-	return func(total int) string {
+// rowsColumns returns the column paths in a rows(...) variable.
+func rowsColumns(value string) ([]string, bool) {
+	inner, ok := strings.CutPrefix(value, "rows(")
+	if !ok {
+		return nil, false
+	}
+	inner, ok = strings.CutSuffix(inner, ")")
+	if !ok {
+		return nil, false
+	}
+	columns := strings.Split(inner, ",")
+	for i, v := range columns {
+		columns[i] = strings.TrimSpace(v)
+	}
+	return columns, true
+}
+
+// buildRowsParamInfo validates the columns in a rows(...) variable. Every column is a path that starts with the
+// same slice parameter, and is applied to each element of the slice.
+func buildRowsParamInfo(ctx context.Context, value string, columns []string, nameOrderMap map[string]int, funcType posType, opts options) (paramInfo, error) {
+	var paramName string
+	for i, v := range columns {
+		id, err := validPath(ctx, v)
+		if err != nil {
+			return paramInfo{}, err
+		}
+		id = markNilSafe(qualify(id, nameOrderMap, opts.namespace), opts)
+		columns[i] = id
+		name, _, _ := strings.Cut(id, ".")
+		if i == 0 {
+			paramName = trimNilSafe(name)
+		} else if trimNilSafe(name) != paramName {
+			return paramInfo{}, QueryError{Kind: InvalidRows, Name: value}
+		}
+	}
+	paramPos, ok := nameOrderMap[paramName]
+	if !ok {
+		return paramInfo{}, QueryError{Kind: ParameterNotFound, Name: paramName}
+	}
+	paramType := funcType.In(paramPos)
+	if paramType == nil {
+		return paramInfo{}, QueryError{Kind: NilParameterPath, Name: paramName}
+	}
+	if paramType.Kind() != reflect.Slice && paramType.Kind() != reflect.Array {
+		return paramInfo{}, QueryError{Kind: InvalidParameterType, Name: paramName, TypeKind: paramType.Kind().String()}
+	}
+	for _, v := range columns {
+		columnType, err := mapper.ExtractDeclaredType(ctx, paramType.Elem(), strings.Split(v, "."))
+		if err != nil {
+			return paramInfo{}, err
+		}
+		if !isBindable(columnType) {
+			return paramInfo{}, QueryError{Kind: UnbindableType, Name: v, TypeKind: columnType.String()}
+		}
+	}
+	return paramInfo{name: paramName, posInParams: paramPos, isSlice: true, columns: columns}, nil
+}
+
+// rowsFactory returns a function that writes out total rows of width placeholders each, like (?, ?), (?, ?).
+// It uses join to write the placeholders, so that positions are tracked in one place.
+func rowsFactory(join func(string, int) string) func(string, int, int) string {
+	return func(name string, width int, total int) string {
+		if total == 0 {
+			//an empty batch is never sent to the database
+			return "NULL"
+		}
+		placeholders := strings.Split(join(name, width*total), ", ")
+		var b strings.Builder
+		for i := 0; i < total; i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("(")
+			b.WriteString(strings.Join(placeholders[i*width:(i+1)*width], ", "))
+			b.WriteString(")")
+		}
+		return b.String()
+	}
+}
+
+var inClause = regexp.MustCompile(`(?i)\b(not\s+)?in\s*\(\s*$`)
+
+// rewriteInClause turns the in ( at the end of text into = ANY( (or not in ( into <> ALL( ), as long as the
+// variable is followed by the closing ).
+func rewriteInClause(text string, next queryToken) (string, bool) {
+	if next.kind != textToken || !strings.HasPrefix(strings.TrimLeft(next.value, " \t\r\n"), ")") {
+		return "", false
+	}
+	loc := inClause.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return "", false
+	}
+	if loc[2] != -1 {
+		return text[:loc[0]] + "<> ALL(", true
+	}
+	return text[:loc[0]] + "= ANY(", true
+}
+
+// endsWithNotIn reports whether text ends with not in (, so that the variable after it is the list for a NOT IN.
+func endsWithNotIn(text string) bool {
+	loc := inClause.FindStringSubmatchIndex(text)
+	return loc != nil && loc[2] != -1
+}
+
+// joinFactory returns a function that writes out total placeholders for the named variable. If the dialect uses
+// numbered placeholders, a name that has already been written out reuses its earlier placeholders. If total is 0,
+// it writes NULL.
+func joinFactory(startPos int, paramAdapter Dialect) func(string, int) string {
+	numbered := isNumbered(paramAdapter)
+	positions := map[string]int{}
+	return func(name string, total int) string {
+		if total == 0 {
+			//an empty list isn't valid SQL, so write a NULL, which never matches anything
+			return "NULL"
+		}
+		pos, ok := positions[name]
+		if !ok || !numbered {
+			pos = startPos
+			positions[name] = pos
+			startPos += total
+		}
 		var b strings.Builder
 		for i := 0; i < total; i++ {
 			if i > 0 {
 				b.WriteString(", ")
 			}
-			b.WriteString(paramAdapter(startPos + i))
+			b.WriteString(paramAdapter.Placeholder(pos + i))
 		}
-		startPos += total
 		return b.String()
 	}
 }
 
+// isNumbered reports whether the placeholders for the dialect refer to a specific parameter, like $1 or :1, rather
+// than the next one, like ?.
+func isNumbered(paramAdapter Dialect) bool {
+	return paramAdapter.Placeholder(1) != paramAdapter.Placeholder(2)
+}
+
 func fixNameForTemplate(name string) string {
 	//need to make sure that foo.bar and fooDOTbar don't collide, however unlikely
 	name = strings.ReplaceAll(name, "DOT", "DOTDOT")
 	name = strings.ReplaceAll(name, ".", "DOT")
 	name = strings.ReplaceAll(name, "DOLLAR", "DOLLARDOLLAR")
 	name = strings.ReplaceAll(name, "$", "DOLLAR")
+	name = strings.ReplaceAll(name, "QMARK", "QMARKQMARK")
+	name = strings.ReplaceAll(name, "?", "QMARK")
 	return name
 }
 
+// escapeTemplateText keeps any {{ in the SQL text from being treated as the start of a template action.
+func escapeTemplateText(text string) string {
+	return strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+}
+
+func addRows(sliceName string, key string, width int) string {
+	return fmt.Sprintf(rowsTemplate, fixNameForTemplate(sliceName), key, width)
+}
+
 func addSlice(sliceName string) string {
-	return fmt.Sprintf(sliceTemplate, fixNameForTemplate(sliceName))
+	return addSliceAs(templateKey(sliceName, nil, false), sliceName)
+}
+
+// addSliceAs writes out a slice whose length is found under dataKey in the template data. It shares placeholders
+// with any other variable written out with the same key.
+func addSliceAs(dataKey string, key string) string {
+	return fmt.Sprintf(sliceTemplate, dataKey, fixNameForTemplate(key))
+}
+
+// templateKey returns the key in the template data for the number of placeholders that a variable needs. The same
+// variable can be expanded in one place and bound as a single value somewhere else, after a transform or as an
+// array, so each of those has a key of its own.
+func templateKey(name string, transforms []namedTransform, asArray bool) string {
+	key := transformsKey(name, transforms)
+	if asArray {
+		key += "[]"
+	}
+	return fixNameForTemplate(key)
 }
 
 func validIdentifier(ctx context.Context, curVar string) (string, error) {
@@ -2,10 +2,15 @@ package proteus
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/jonbodner/proteus/mapper"
 )
 
 func TestFixNameForTemplate(t *testing.T) {
@@ -74,6 +79,19 @@ func Test_buildParamMap(t *testing.T) {
 				"c": 3,
 			},
 		},
+		{
+			name: "defaults",
+			args: args{
+				prop:       "a, limit = 50,offset=0",
+				paramCount: 3,
+				startPos:   2,
+			},
+			want: map[string]int{
+				"a":      2,
+				"limit":  3,
+				"offset": 4,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -124,7 +142,7 @@ func Test_convertToPositionalParameters(t *testing.T) {
 	}
 	ctx := context.Background()
 	for _, tt := range tests {
-		got, got1, err := buildFixedQueryAndParamOrder(ctx, tt.args.query, tt.args.paramMap, tt.args.funcType, tt.args.pa)
+		got, got1, err := buildFixedQueryAndParamOrder(ctx, tt.args.query, tt.args.paramMap, tt.args.funcType, tt.args.pa, options{})
 		if (err != nil) != tt.wantErr {
 			t.Errorf("%q. buildFixedQueryAndParamOrder() error = %v, wantErr %v", tt.name, err, tt.wantErr)
 			continue
@@ -146,7 +164,7 @@ func Test_joinFactory(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want func(int) string
+		want func(string, int) string
 	}{
 		// TODO: Add test cases.
 	}
@@ -229,3 +247,342 @@ func TestBuilderBadFunction(t *testing.T) {
 		t.Error("should return error")
 	}
 }
+
+func TestRepeatedParameters(t *testing.T) {
+	var f func(Executor, string, []int)
+	data := []struct {
+		name    string
+		pa      Dialect
+		args    []reflect.Value
+		query   string
+		qps     []paramInfo
+		capture string
+	}{
+		{
+			name:    "postgres",
+			pa:      PostgresDialect,
+			args:    []reflect.Value{{}, reflect.ValueOf("a"), reflect.ValueOf([]int{1, 2})},
+			query:   "insert into foo(id, name) values ($1, $2) on conflict (id) do update set name = $2 where id in ($3, $4) or name = $2 or id in ($3, $4)",
+			qps:     []paramInfo{{name: "id", posInParams: 1}, {name: "name", posInParams: 1}, {name: "ids", posInParams: 2, isSlice: true}},
+			capture: "insert into foo(id, name) values (:id:, :name:) on conflict (id) do update set name = :name: where id in (:ids:) or name = :name: or id in (:ids:)",
+		},
+		{
+			name:    "mysql",
+			pa:      MySQLDialect,
+			args:    []reflect.Value{{}, reflect.ValueOf("a"), reflect.ValueOf([]int{1, 2})},
+			query:   "insert into foo(id, name) values (?, ?) on conflict (id) do update set name = ? where id in (?, ?) or name = ? or id in (?, ?)",
+			qps:     []paramInfo{{name: "id", posInParams: 1}, {name: "name", posInParams: 1}, {name: "name", posInParams: 1}, {name: "ids", posInParams: 2, isSlice: true}, {name: "name", posInParams: 1}, {name: "ids", posInParams: 2, isSlice: true}},
+			capture: "insert into foo(id, name) values (:id:, :name:) on conflict (id) do update set name = :name: where id in (:ids:) or name = :name: or id in (:ids:)",
+		},
+	}
+	ctx := context.Background()
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			q, qps, err := buildFixedQueryAndParamOrder(ctx, v.capture, map[string]int{"id": 1, "name": 1, "ids": 2}, reflect.TypeOf(f), v.pa, options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := q.finalize(ctx, v.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != v.query {
+				t.Errorf("expected %s, got %s", v.query, query)
+			}
+			if diff := cmp.Diff(v.qps, qps, cmp.AllowUnexported(paramInfo{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestArrayBinding(t *testing.T) {
+	var f func(Querier, []int, []string, string)
+	nameOrderMap := map[string]int{"ids": 1, "names": 2, "name": 3}
+	args := []reflect.Value{{}, reflect.ValueOf([]int{1, 2, 3}), reflect.ValueOf([]string{"a", "b"}), reflect.ValueOf("c")}
+	data := []struct {
+		name  string
+		pa    Dialect
+		opts  options
+		in    string
+		query string
+		qps   []paramInfo
+	}{
+		{
+			name:  "postgres",
+			pa:    PostgresDialect,
+			opts:  options{arrays: true},
+			in:    "select * from foo where id IN ( :ids: ) and name not in (:names:) and name = :name: and id in (:ids:, 4)",
+			query: "select * from foo where id = ANY($1 ) and name <> ALL($2) and name = $3 and id in ($4, $5, $6, 4)",
+			qps: []paramInfo{
+				{name: "ids", posInParams: 1, asArray: true},
+				{name: "names", posInParams: 2, asArray: true},
+				{name: "name", posInParams: 3},
+				{name: "ids", posInParams: 1, isSlice: true},
+			},
+		},
+		{
+			name:  "expanded before array",
+			pa:    PostgresDialect,
+			opts:  options{arrays: true},
+			in:    "select :ids: from foo where id in (:ids:)",
+			query: "select $1, $2, $3 from foo where id = ANY($4)",
+			qps: []paramInfo{
+				{name: "ids", posInParams: 1, isSlice: true},
+				{name: "ids", posInParams: 1, asArray: true},
+			},
+		},
+		{
+			name:  "postgres without option",
+			pa:    PostgresDialect,
+			in:    "select * from foo where id in (:ids:)",
+			query: "select * from foo where id in ($1, $2, $3)",
+			qps:   []paramInfo{{name: "ids", posInParams: 1, isSlice: true}},
+		},
+		{
+			name:  "mysql",
+			pa:    MySQLDialect,
+			opts:  options{arrays: true},
+			in:    "select * from foo where id in (:ids:)",
+			query: "select * from foo where id in (?, ?, ?)",
+			qps:   []paramInfo{{name: "ids", posInParams: 1, isSlice: true}},
+		},
+	}
+	ctx := context.Background()
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			q, qps, err := buildFixedQueryAndParamOrder(ctx, v.in, nameOrderMap, reflect.TypeOf(f), v.pa, v.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(v.qps, qps, cmp.AllowUnexported(paramInfo{})); diff != "" {
+				t.Error(diff)
+			}
+			query, err := q.finalize(ctx, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != v.query {
+				t.Errorf("expected %s, got %s", v.query, query)
+			}
+			queryArgs, err := buildQueryArgs(ctx, args, qps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			//every placeholder has a value, and every value has a placeholder
+			if count := strings.Count(query, "$") + strings.Count(query, "?"); count != len(queryArgs) {
+				t.Errorf("expected %d args, got %d", count, len(queryArgs))
+			}
+		})
+	}
+}
+
+func TestArrayBindingArgs(t *testing.T) {
+	ctx := context.Background()
+	args := []reflect.Value{{}, reflect.ValueOf([]int{1, 2, 3})}
+	queryArgs, err := buildQueryArgs(ctx, args, []paramInfo{{name: "ids", posInParams: 1, asArray: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queryArgs) != 1 {
+		t.Fatalf("expected 1 arg, got %d", len(queryArgs))
+	}
+	valuer, ok := queryArgs[0].(driver.Valuer)
+	if !ok {
+		t.Fatalf("expected a driver.Valuer, got %T", queryArgs[0])
+	}
+	val, err := valuer.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "{1,2,3}" {
+		t.Errorf("expected {1,2,3}, got %v", val)
+	}
+}
+
+func TestSliceProjection(t *testing.T) {
+	type Customer struct {
+		Name string
+	}
+	type Product struct {
+		Id       int
+		Customer *Customer
+	}
+	var f func(Querier, []Product, []map[string]any)
+	nameOrderMap := map[string]int{"products": 1, "rows": 2}
+	args := []reflect.Value{
+		{},
+		reflect.ValueOf([]Product{{Id: 1, Customer: &Customer{Name: "a"}}, {Id: 2, Customer: &Customer{Name: "b"}}}),
+		reflect.ValueOf([]map[string]any{{"code": "x"}, {"code": "y"}, {"code": "z"}}),
+	}
+	ctx := context.Background()
+	q, qps, err := buildFixedQueryAndParamOrder(ctx,
+		"select * from foo where id in (:products.Id:) and customer in (:products.Customer.Name:) and code in (:rows.code:) and first = :products.0.Id:",
+		nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := q.finalize(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "select * from foo where id in ($1, $2) and customer in ($3, $4) and code in ($5, $6, $7) and first = $8"
+	if query != want {
+		t.Errorf("expected %s, got %s", want, query)
+	}
+	queryArgs, err := buildQueryArgs(ctx, args, qps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{1, 2, "a", "b", "x", "y", "z", 1}, queryArgs); diff != "" {
+		t.Error(diff)
+	}
+
+	_, _, err = buildFixedQueryAndParamOrder(ctx, "select * from foo where id in (:products.Missing:)", nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+	if !errors.Is(err, mapper.ExtractError{Kind: mapper.NoSuchFieldType}) {
+		t.Errorf("expected NoSuchFieldType, got %v", err)
+	}
+}
+
+func TestRows(t *testing.T) {
+	type Product struct {
+		Id   int
+		Name string
+		Tags map[string]string
+	}
+	var f func(Executor, []Product, string)
+	nameOrderMap := map[string]int{"p": 1, "name": 2}
+	args := []reflect.Value{
+		{},
+		reflect.ValueOf([]Product{{Id: 1, Name: "a", Tags: map[string]string{"color": "red"}}, {Id: 2, Name: "b", Tags: map[string]string{"color": "blue"}}}),
+		reflect.ValueOf("c"),
+	}
+	ctx := context.Background()
+	data := []struct {
+		name  string
+		pa    Dialect
+		query string
+	}{
+		{"postgres", PostgresDialect, "insert into foo(id, name, color, batch) values ($1, $2, $3), ($4, $5, $6) on conflict do update set batch = $7"},
+		{"mysql", MySQLDialect, "insert into foo(id, name, color, batch) values (?, ?, ?), (?, ?, ?) on conflict do update set batch = ?"},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			q, qps, err := buildFixedQueryAndParamOrder(ctx,
+				"insert into foo(id, name, color, batch) values :rows(p.Id, p.Name, p.Tags.color): on conflict do update set batch = :name:",
+				nameOrderMap, reflect.TypeOf(f), v.pa, options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := q.finalize(ctx, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != v.query {
+				t.Errorf("expected %s, got %s", v.query, query)
+			}
+			queryArgs, err := buildQueryArgs(ctx, args, qps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]any{1, "a", "red", 2, "b", "blue", "c"}, queryArgs); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	errData := []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{"different slices", "values :rows(p.Id, q.Name):", QueryError{Kind: InvalidRows}},
+		{"not a slice", "values :rows(name):", QueryError{Kind: InvalidParameterType}},
+		{"no such field", "values :rows(p.Id, p.Cost):", mapper.ExtractError{Kind: mapper.NoSuchFieldType}},
+		{"no such parameter", "values :rows(x.Id):", QueryError{Kind: ParameterNotFound}},
+	}
+	for _, v := range errData {
+		t.Run(v.name, func(t *testing.T) {
+			_, _, err := buildFixedQueryAndParamOrder(ctx, v.query, nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+			if !errors.Is(err, v.err) {
+				t.Errorf("expected %v, got %v", v.err, err)
+			}
+		})
+	}
+}
+
+func TestFragments(t *testing.T) {
+	type Filter struct {
+		Name *string
+		Cost sql.NullFloat64
+		Ids  []int
+	}
+	var f func(Querier, string, Filter)
+	nameOrderMap := map[string]int{"status": 1, "f": 2}
+	query := "select * from foo where status = :status:[[ and name = :f.Name:]][[ and cost < :f.Cost:]][[ and id in (:f.Ids:)[[ or name = :f.Name:]]]][[ or status = :status:]]"
+	name := "a"
+	ctx := context.Background()
+	data := []struct {
+		name      string
+		pa        Dialect
+		filter    Filter
+		query     string
+		queryArgs []any
+	}{
+		{
+			name:      "nothing",
+			pa:        PostgresDialect,
+			query:     "select * from foo where status = $1 or status = $1",
+			queryArgs: []any{"s"},
+		},
+		{
+			name:      "everything",
+			pa:        PostgresDialect,
+			filter:    Filter{Name: &name, Cost: sql.NullFloat64{Float64: 10, Valid: true}, Ids: []int{1, 2}},
+			query:     "select * from foo where status = $1 and name = $2 and cost < $3 and id in ($4, $5) or name = $6 or status = $1",
+			queryArgs: []any{"s", &name, 10.0, 1, 2, &name},
+		},
+		{
+			name:      "empty slice drops the fragments inside of it",
+			pa:        PostgresDialect,
+			filter:    Filter{Name: &name, Ids: []int{}},
+			query:     "select * from foo where status = $1 and name = $2 or status = $1",
+			queryArgs: []any{"s", &name},
+		},
+		{
+			name:      "question marks",
+			pa:        MySQLDialect,
+			filter:    Filter{Cost: sql.NullFloat64{Float64: 10, Valid: true}},
+			query:     "select * from foo where status = ? and cost < ? or status = ?",
+			queryArgs: []any{"s", 10.0, "s"},
+		},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			q, qps, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, reflect.TypeOf(f), v.pa, options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := []reflect.Value{{}, reflect.ValueOf("s"), reflect.ValueOf(v.filter)}
+			finalQuery, err := q.finalize(ctx, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if finalQuery != v.query {
+				t.Errorf("expected %s, got %s", v.query, finalQuery)
+			}
+			queryArgs, err := buildQueryArgs(ctx, args, qps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(v.queryArgs, queryArgs); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	_, _, err := buildFixedQueryAndParamOrder(ctx, "select * from foo [[ where 1 = 1 ]]", nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+	if !errors.Is(err, QueryError{Kind: EmptyFragment}) {
+		t.Errorf("expected EmptyFragment, got %v", err)
+	}
+}
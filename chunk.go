@@ -0,0 +1,154 @@
+package proteus
+
+import (
+	"database/sql"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// chunker splits the slice parameter of a function into pieces, so that each run of the query stays within the
+// dialect's limit on the number of parameters in a statement.
+type chunker struct {
+	pos         int // position of the slice in the function parameters
+	occurrences int // number of placeholders written for each element of the slice
+	maxParams   int
+}
+
+func newChunker(funcType posType, paramOrder []paramInfo, maxParams int) (*chunker, error) {
+	var names []string
+	var positions []int
+	c := chunker{maxParams: maxParams}
+	for _, v := range paramOrder {
+		if v.page {
+			//each chunk would get its own page, so the combined results wouldn't be a page of anything
+			return nil, QueryError{Kind: ChunkNotSupported, Name: v.name}
+		}
+		if !v.isSlice || v.reused {
+			continue
+		}
+		if !slices.Contains(names, v.name) {
+			names = append(names, v.name)
+		}
+		//different paths into the same parameter are split together
+		if !slices.Contains(positions, v.posInParams) {
+			positions = append(positions, v.posInParams)
+		}
+		c.pos = v.posInParams
+		c.occurrences += max(len(v.columns), 1)
+	}
+	if len(names) == 0 {
+		//nothing to split
+		return nil, nil
+	}
+	if len(positions) > 1 {
+		return nil, QueryError{Kind: ChunkNotSupported, Name: strings.Join(names, ", ")}
+	}
+	for _, name := range names {
+		if !isParamSlice(funcType, c.pos, name) {
+			return nil, QueryError{Kind: ChunkNotSupported, Name: name}
+		}
+	}
+	return &c, nil
+}
+
+// buildChunker returns the chunker for a function, or nil if its queries are never split. Queries are split when
+// chunking is enabled, or when they write a batch of rows and the results can be combined.
+func buildChunker(funcType reflect.Type, paramOrder []paramInfo, pa Dialect, opts options) (*chunker, error) {
+	if opts.chunk {
+		return newChunker(funcType, paramOrder, pa.MaxParams())
+	}
+	if !hasRows(paramOrder) || !canCombine(funcType) {
+		return nil, nil
+	}
+	chunk, err := newChunker(funcType, paramOrder, pa.MaxParams())
+	if err != nil {
+		//not asked for, so just run the query as-is
+		return nil, nil
+	}
+	return chunk, nil
+}
+
+func hasRows(paramOrder []paramInfo) bool {
+	for _, v := range paramOrder {
+		if len(v.columns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// canCombine reports whether the results of running a function's query more than once can be combined.
+func canCombine(funcType reflect.Type) bool {
+	if funcType.NumOut() == 0 {
+		return true
+	}
+	if funcType.Out(0).Kind() == reflect.Slice {
+		return true
+	}
+	//executors return an int64 or sql.Result, and those are added up
+	first := funcType.In(0)
+	if first.Implements(contextType) {
+		return funcType.In(1).Implements(conExType)
+	}
+	return first.Implements(exType)
+}
+
+// isParamSlice reports whether the slice named by path is the function parameter itself, or a path applied to each
+// of its elements, so that splitting the parameter splits the slice.
+func isParamSlice(funcType posType, pos int, path string) bool {
+	if funcType.In(pos).Kind() != reflect.Slice {
+		return false
+	}
+	_, next, found := strings.Cut(path, ".")
+	if !found {
+		return true
+	}
+	next, _, _ = strings.Cut(next, ".")
+	_, err := strconv.Atoi(next)
+	return err != nil
+}
+
+// split returns the function arguments for each run of the query. queryArgCount is the number of parameters
+// needed to run the query for all of the args at once. If no splitting is needed, the only entry is args.
+func (c *chunker) split(args []reflect.Value, queryArgCount int) [][]reflect.Value {
+	if c == nil || c.maxParams <= 0 || queryArgCount <= c.maxParams {
+		return [][]reflect.Value{args}
+	}
+	slice := args[c.pos]
+	total := slice.Len()
+	size := (c.maxParams - (queryArgCount - total*c.occurrences)) / c.occurrences
+	if size < 1 {
+		//can't fit even one value in, so let the database report the error
+		return [][]reflect.Value{args}
+	}
+	var out [][]reflect.Value
+	for start := 0; start < total; start += size {
+		chunkArgs := slices.Clone(args)
+		chunkArgs[c.pos] = slice.Slice(start, min(start+size, total))
+		out = append(out, chunkArgs)
+	}
+	return out
+}
+
+// chunkedResult combines the results from running an Exec once per chunk.
+type chunkedResult []sql.Result
+
+// LastInsertId returns the LastInsertId of the last chunk.
+func (cr chunkedResult) LastInsertId() (int64, error) {
+	return cr[len(cr)-1].LastInsertId()
+}
+
+// RowsAffected returns the total of the RowsAffected for each chunk.
+func (cr chunkedResult) RowsAffected() (int64, error) {
+	var total int64
+	for _, v := range cr {
+		count, err := v.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
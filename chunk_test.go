@@ -0,0 +1,230 @@
+package proteus
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type recordingExecutor struct {
+	Queries []string
+	Args    [][]any
+}
+
+func (re *recordingExecutor) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	re.Queries = append(re.Queries, query)
+	re.Args = append(re.Args, args)
+	return driver.RowsAffected(len(args) - 1), nil
+}
+
+func TestChunking(t *testing.T) {
+	ctx := context.Background()
+	limited := dialect{placeholder: Postgres, quoteOpen: `"`, quoteClose: `"`, maxParams: 3}
+	var f struct {
+		Delete func(ctx context.Context, e ContextExecutor, name string, ids []int) (int64, error) `proq:"delete from foo where name = :name: and id in (:ids:)" prop:"name,ids" proopt:"chunk"`
+		Plain  func(ctx context.Context, e ContextExecutor, name string, ids []int) (int64, error) `proq:"delete from foo where name = :name: and id in (:ids:)" prop:"name,ids"`
+	}
+	err := ShouldBuild(ctx, &f, Postgres, WithDialect(limited))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re := &recordingExecutor{}
+	count, err := f.Delete(ctx, re, "a", []int{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected 5 rows affected, got %d", count)
+	}
+	wantQueries := []string{
+		"delete from foo where name = $1 and id in ($2, $3)",
+		"delete from foo where name = $1 and id in ($2, $3)",
+		"delete from foo where name = $1 and id in ($2)",
+	}
+	wantArgs := [][]any{{"a", 1, 2}, {"a", 3, 4}, {"a", 5}}
+	if diff := cmp.Diff(wantQueries, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(wantArgs, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// without the tag, the query is run once, and it's up to the database to complain
+	re = &recordingExecutor{}
+	_, err = f.Plain(ctx, re, "a", []int{1, 2, 3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(re.Queries) != 1 {
+		t.Errorf("expected 1 query, got %d", len(re.Queries))
+	}
+
+	// more than one path into the same slice is split together
+	type item struct {
+		Id   int
+		Name string
+	}
+	var g struct {
+		Delete func(ctx context.Context, e ContextExecutor, ps []item) (int64, error) `proq:"delete from foo where id in (:ps.Id:) and name in (:ps.Name:)" prop:"ps" proopt:"chunk"`
+	}
+	if err = ShouldBuild(ctx, &g, Postgres, WithDialect(limited)); err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = g.Delete(ctx, re, []item{{1, "a"}, {2, "b"}, {3, "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	wantQueries = []string{
+		"delete from foo where id in ($1) and name in ($2)",
+		"delete from foo where id in ($1) and name in ($2)",
+		"delete from foo where id in ($1) and name in ($2)",
+	}
+	if diff := cmp.Diff(wantQueries, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{1, "a"}, {2, "b"}, {3, "c"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestChunkingErrors(t *testing.T) {
+	ctx := context.Background()
+	var twoSlices struct {
+		F func(ctx context.Context, e ContextExecutor, ids []int, names []string) (int64, error) `proq:"delete from foo where id in (:ids:) or name in (:names:)" prop:"ids,names"`
+	}
+	err := ShouldBuild(ctx, &twoSlices, Postgres, WithChunking())
+	if !errors.Is(err, QueryError{Kind: ChunkNotSupported}) {
+		t.Errorf("expected ChunkNotSupported, got %v", err)
+	}
+
+	var paged struct {
+		F func(ctx context.Context, q ContextQuerier, ids []int, p Page) ([]int, error) `proq:"select id from foo where id in (:ids:) order by id :p:" prop:"ids,p" proopt:"chunk"`
+	}
+	err = ShouldBuild(ctx, &paged, Postgres)
+	var qe QueryError
+	if !errors.As(err, &qe) || qe.Kind != ChunkNotSupported || qe.Name != "p" {
+		t.Errorf("expected ChunkNotSupported for p, got %v", err)
+	}
+
+	var nested struct {
+		F func(ctx context.Context, e ContextExecutor, p struct{ Ids []int }) (int64, error) `proq:"delete from foo where id in (:p.Ids:)" prop:"p" proopt:"chunk"`
+	}
+	err = ShouldBuild(ctx, &nested, Postgres)
+	if !errors.Is(err, QueryError{Kind: ChunkNotSupported}) {
+		t.Errorf("expected ChunkNotSupported, got %v", err)
+	}
+
+	var single struct {
+		F func(ctx context.Context, q ContextQuerier, ids []int) (int, error) `proq:"select count(*) from foo where id in (:ids:)" prop:"ids" proopt:"chunk"`
+	}
+	err = ShouldBuild(ctx, &single, Postgres)
+	if !errors.Is(err, ValidationError{Kind: ChunkedReturnType}) {
+		t.Errorf("expected ChunkedReturnType, got %v", err)
+	}
+
+	var unknown struct {
+		F func(ctx context.Context, q ContextQuerier, ids []int) ([]int, error) `proq:"select id from foo where id in (:ids:)" prop:"ids" proopt:"chunky"`
+	}
+	err = ShouldBuild(ctx, &unknown, Postgres)
+	if !errors.Is(err, QueryError{Kind: UnknownOption}) {
+		t.Errorf("expected UnknownOption, got %v", err)
+	}
+}
+
+func TestChunkerSplit(t *testing.T) {
+	// the slice is expanded twice, along with one other parameter
+	c := &chunker{pos: 1, occurrences: 2, maxParams: 7}
+	args := []reflect.Value{reflect.ValueOf("a"), reflect.ValueOf([]int{1, 2, 3, 4, 5, 6, 7})}
+	chunks := c.split(args, 15)
+	var got [][]int
+	for _, v := range chunks {
+		if v[0].Interface() != "a" {
+			t.Errorf("unexpected first arg %v", v[0])
+		}
+		got = append(got, v[1].Interface().([]int))
+	}
+	if diff := cmp.Diff([][]int{{1, 2, 3}, {4, 5, 6}, {7}}, got); diff != "" {
+		t.Error(diff)
+	}
+
+	if chunks := c.split(args, 7); len(chunks) != 1 {
+		t.Errorf("expected 1 chunk when under the limit, got %d", len(chunks))
+	}
+	var none *chunker
+	if chunks := none.split(args, 100); len(chunks) != 1 {
+		t.Errorf("expected 1 chunk without a chunker, got %d", len(chunks))
+	}
+}
+
+func TestChunkedResult(t *testing.T) {
+	cr := chunkedResult{driver.RowsAffected(2), driver.RowsAffected(3)}
+	count, err := cr.RowsAffected()
+	if err != nil || count != 5 {
+		t.Errorf("expected 5, nil; got %d, %v", count, err)
+	}
+}
+
+func TestRowsChunking(t *testing.T) {
+	ctx := context.Background()
+	type Product struct {
+		Id   int
+		Name string
+	}
+	limited := dialect{placeholder: MySQL, quoteOpen: `"`, quoteClose: `"`, maxParams: 5}
+	var f struct {
+		Insert func(ctx context.Context, e ContextExecutor, p []Product) (int64, error) `proq:"insert into product(id, name) values :rows(p.Id, p.Name):" prop:"p"`
+	}
+	err := ShouldBuild(ctx, &f, MySQL, WithDialect(limited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	products := []Product{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}, {5, "e"}}
+	wantQueries := []string{
+		"insert into product(id, name) values (?, ?), (?, ?)",
+		"insert into product(id, name) values (?, ?), (?, ?)",
+		"insert into product(id, name) values (?, ?)",
+	}
+	wantArgs := [][]any{{1, "a", 2, "b"}, {3, "c", 4, "d"}, {5, "e"}}
+
+	// batches of rows are split without needing to be asked
+	re := &recordingExecutor{}
+	count, err := f.Insert(ctx, re, products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 7 {
+		t.Errorf("expected 7 rows affected (one less than the parameters in each statement), got %d", count)
+	}
+	if diff := cmp.Diff(wantQueries, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(wantArgs, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	re = &recordingExecutor{}
+	b := NewBuilder(MySQL, WithDialect(limited))
+	_, err = b.Exec(ctx, re, "insert into product(id, name) values :rows(p.Id, p.Name):", map[string]any{"p": products})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantQueries, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(wantArgs, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// an empty batch isn't sent
+	re = &recordingExecutor{}
+	count, err = f.Insert(ctx, re, nil)
+	if err != nil || count != 0 || len(re.Queries) != 0 {
+		t.Errorf("Expected 0, nil and no queries; got %d, %v, %v", count, err, re.Queries)
+	}
+}
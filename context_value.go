@@ -0,0 +1,55 @@
+package proteus
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/jonbodner/proteus/mapper"
+)
+
+// contextPrefix starts the name of a variable whose value comes from the context, like ctx.tenant.
+const contextPrefix = "ctx."
+
+// isContextVariable reports whether a variable refers to a value in the context, rather than to a parameter. A
+// parameter called ctx takes precedence.
+func isContextVariable(id string, nameOrderMap map[string]int) bool {
+	if _, ok := nameOrderMap["ctx"]; ok {
+		return false
+	}
+	return strings.HasPrefix(id, contextPrefix)
+}
+
+// buildContextParamInfo finds the key registered for a context variable. The part of the path after ctx is the name
+// that the key was registered with, optionally followed by a path into the value.
+func buildContextParamInfo(id string, funcType posType, opts options) (paramInfo, error) {
+	if !hasContextParam(funcType) {
+		return paramInfo{}, QueryError{Kind: NoContextParameter, Name: id}
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(id, contextPrefix), ".")
+	key, ok := opts.contextKeys[name]
+	if !ok {
+		return paramInfo{}, QueryError{Kind: UnknownContextValue, Name: id}
+	}
+	return paramInfo{name: id, contextKey: key}, nil
+}
+
+// hasContextParam reports whether a function is passed a context when it is called. The parameter types for an
+// ad-hoc query don't include the context, but those queries are always run with one.
+func hasContextParam(funcType posType) bool {
+	if _, ok := funcType.(sliceTypes); ok {
+		return true
+	}
+	ft, ok := funcType.(reflect.Type)
+	return ok && ft.NumIn() > 0 && ft.In(0).Implements(contextType)
+}
+
+// contextValue returns the value for a context variable from the context passed to the function.
+func contextValue(ctx context.Context, v paramInfo) (any, error) {
+	val := ctx.Value(v.contextKey)
+	if val == nil {
+		return nil, QueryError{Kind: MissingContextValue, Name: v.name}
+	}
+	path := strings.Split(strings.TrimPrefix(v.name, contextPrefix), ".")
+	return mapper.Extract(ctx, val, path)
+}
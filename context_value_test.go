@@ -0,0 +1,107 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type tenantKey struct{}
+
+type userKey struct{}
+
+type contextUser struct {
+	ID   int
+	Name string
+}
+
+func TestContextValues(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Update func(ctx context.Context, e ContextExecutor, name string) (int64, error) `proq:"update foo set name = :name:, updated_by = :ctx.user.ID: where tenant_id = :ctx.tenant: and name <> :ctx.user.Name|lower:[[ and owner = :ctx.tenant: ]]" prop:"name"`
+		Owner  func(ctx context.Context, e ContextExecutor, name string) (int64, error) `proq:"update foo set name = :name:[[ where owner_id = :ctx.user.ID: ]]" prop:"name"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(ctx, &sImpl, Postgres, WithContextValue("tenant", tenantKey{}), WithContextValue("user", userKey{}))
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	callCtx := context.WithValue(ctx, tenantKey{}, 10)
+	callCtx = context.WithValue(callCtx, userKey{}, contextUser{ID: 5, Name: "Bob"})
+	re := &recordingExecutor{}
+	if _, err = sImpl.Update(callCtx, re, "fred"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.Owner(callCtx, re, "fred"); err != nil {
+		t.Fatal(err)
+	}
+	// an optional condition is left out when the value isn't in the context
+	if _, err = sImpl.Owner(ctx, re, "fred"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"update foo set name = $1, updated_by = $2 where tenant_id = $3 and name <> $4 and owner = $3 ",
+		"update foo set name = $1 where owner_id = $2 ",
+		"update foo set name = $1",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"fred", 5, 10, "bob"}, {"fred", 5}, {"fred"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// a missing value is an error, rather than a NULL
+	re = &recordingExecutor{}
+	_, err = sImpl.Update(context.WithValue(ctx, userKey{}, contextUser{}), re, "fred")
+	var qe QueryError
+	if !errors.As(err, &qe) || qe.Kind != MissingContextValue || qe.Name != "ctx.tenant" {
+		t.Errorf("Expected MissingContextValue error, got %v", err)
+	}
+	if len(re.Queries) != 0 {
+		t.Errorf("Expected no queries, got %v", re.Queries)
+	}
+
+	// ad-hoc queries use the context that they are run with
+	b := NewBuilder(MySQL, WithContextValue("tenant", tenantKey{}))
+	_, err = b.Exec(callCtx, re, "update foo set a = :a: where tenant_id = :ctx.tenant:", map[string]any{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]any{{1, 10}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// a parameter called ctx is used instead of the context
+	type param struct {
+		F func(ctx context.Context, e ContextExecutor, c map[string]int) (int64, error) `proq:"update foo set a = :ctx.tenant:" prop:"ctx"`
+	}
+	p := param{}
+	if err = ShouldBuild(ctx, &p, Postgres, WithContextValue("tenant", tenantKey{})); err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = p.F(callCtx, re, map[string]int{"tenant": 20}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]any{{20}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	type noContext struct {
+		F func(e Executor) (int64, error) `proq:"update foo set a = 1 where tenant_id = :ctx.tenant:"`
+	}
+	err = ShouldBuild(ctx, &noContext{}, Postgres, WithContextValue("tenant", tenantKey{}))
+	if !errors.Is(err, QueryError{Kind: NoContextParameter}) {
+		t.Errorf("Expected NoContextParameter error, got %v", err)
+	}
+	type unknown struct {
+		F func(ctx context.Context, e ContextExecutor) (int64, error) `proq:"update foo set a = 1 where tenant_id = :ctx.tenant:"`
+	}
+	err = ShouldBuild(ctx, &unknown{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: UnknownContextValue}) {
+		t.Errorf("Expected UnknownContextValue error, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package proteus
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jonbodner/proteus/mapper"
+)
+
+// Cursor is an opaque token that marks a position in the rows returned by a query, for keyset pagination. A Querier
+// function that returns ([]T, Cursor, error) returns a Cursor that holds the key columns of the last row, and a
+// query refers to a Cursor parameter like any other variable, as in where :after: order by id. The variable is
+// replaced with a predicate that only matches the rows after the ones that were already returned. The empty Cursor
+// starts at the beginning.
+//
+// The key columns are marked with the key option in the prof struct tags of the result, like prof:"id,key", or
+// declared with WithKeyColumns or the prokey struct tag.
+type Cursor string
+
+var cursorType = reflect.TypeFor[Cursor]()
+
+func init() {
+	//driver.Value types that aren't registered with gob by default
+	gob.Register(time.Time{})
+}
+
+// cursorData is what a Cursor holds: the names of the key columns, and their values in the last row.
+type cursorData struct {
+	Keys   []string
+	Values []any
+}
+
+// keyColumn is a column that identifies the position of a row in the order of a query.
+type keyColumn struct {
+	name string // the name of the column in the result
+	expr string // the expression that is compared in the predicate
+	desc bool
+}
+
+// parseKeyColumns converts the values passed to WithKeyColumns. Each one is a column name, optionally starting with a
+// - for descending order and followed by = and the expression for the column in the query.
+func parseKeyColumns(columns []string) ([]keyColumn, error) {
+	out := make([]keyColumn, 0, len(columns))
+	for _, v := range columns {
+		var k keyColumn
+		name, expr, ok := strings.Cut(strings.TrimSpace(v), "=")
+		name, k.desc = strings.CutPrefix(strings.TrimSpace(name), "-")
+		k.name, k.expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok {
+			k.expr = k.name
+		}
+		//a row value comparison only goes in one direction
+		if k.name == "" || k.expr == "" || (len(out) > 0 && k.desc != out[0].desc) {
+			return nil, QueryError{Kind: InvalidKeyColumns, Name: strings.Join(columns, ",")}
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// keyNames returns the names of the key columns.
+func keyNames(keys []keyColumn) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k.name
+	}
+	return out
+}
+
+// addCursor writes out the predicate for a Cursor. With row values, it looks like (a, b) > (?, ?). Otherwise, it
+// looks like (a > ? OR (a = ? AND b > ?)). If the Cursor is empty, it writes out 1 = 1. It returns the template and
+// the index of the key column for each value that needs to be bound, in order.
+func addCursor(name string, key string, keys []keyColumn, pa Dialect) (string, []int) {
+	op := " > "
+	if keys[0].desc {
+		op = " < "
+	}
+	numbered := isNumbered(pa)
+	var order []int
+	placeholder := func(i int) string {
+		if !numbered || !slices.Contains(order, i) {
+			order = append(order, i)
+		}
+		return fmt.Sprintf("{{join %q 1}}", fmt.Sprintf("%s#%d", key, i))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "{{if index . %q}}", identifierKey(name))
+	switch {
+	case len(keys) == 1:
+		b.WriteString(escapeTemplateText(keys[0].expr) + op + placeholder(0))
+	case pa.SupportsRowValues():
+		exprs := make([]string, len(keys))
+		placeholders := make([]string, len(keys))
+		for i, k := range keys {
+			exprs[i] = escapeTemplateText(k.expr)
+			placeholders[i] = placeholder(i)
+		}
+		b.WriteString("(" + strings.Join(exprs, ", ") + ")" + op + "(" + strings.Join(placeholders, ", ") + ")")
+	default:
+		terms := make([]string, len(keys))
+		for i := range keys {
+			parts := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				parts = append(parts, escapeTemplateText(keys[j].expr)+" = "+placeholder(j))
+			}
+			parts = append(parts, escapeTemplateText(keys[i].expr)+op+placeholder(i))
+			terms[i] = strings.Join(parts, " AND ")
+			if i > 0 {
+				terms[i] = "(" + terms[i] + ")"
+			}
+		}
+		b.WriteString("(" + strings.Join(terms, " OR ") + ")")
+	}
+	b.WriteString("{{else}}1 = 1{{end}}")
+	return b.String(), order
+}
+
+// buildCursorParamInfo makes sure that there are key columns for a Cursor variable.
+func buildCursorParamInfo(id string, paramPos int, opts options) (paramInfo, []keyColumn, error) {
+	if len(opts.keyColumns) == 0 {
+		return paramInfo{}, nil, QueryError{Kind: NoKeyColumns, Name: id}
+	}
+	keys, err := parseKeyColumns(opts.keyColumns)
+	if err != nil {
+		return paramInfo{}, nil, err
+	}
+	return paramInfo{name: id, posInParams: paramPos, cursor: true, keyNames: keyNames(keys)}, keys, nil
+}
+
+// resultKeyColumns returns the key columns marked in the prof struct tags of the struct in the slice that a function
+// returns, or nil if there aren't any.
+func resultKeyColumns(funcType reflect.Type) []string {
+	if funcType.NumOut() == 0 || funcType.Out(0).Kind() != reflect.Slice {
+		return nil
+	}
+	return mapper.KeyColumns(funcType.Out(0).Elem())
+}
+
+// cursorValue returns the Cursor for a variable. A nil *Cursor is the same as an empty one.
+func cursorValue(val any) Cursor {
+	rv := reflect.Indirect(reflect.ValueOf(val))
+	if !rv.IsValid() {
+		return ""
+	}
+	return Cursor(rv.String())
+}
+
+// cursorArgs returns the values to bind for a Cursor, or nil if it is empty.
+func cursorArgs(val any, v paramInfo) ([]any, error) {
+	c := cursorValue(val)
+	if c == "" {
+		return nil, nil
+	}
+	data, err := decodeCursor(c)
+	if err != nil || !validCursor(data, v.keyNames) {
+		return nil, QueryError{Kind: InvalidCursor, Name: v.name}
+	}
+	out := make([]any, 0, len(v.cursorOrder))
+	for _, i := range v.cursorOrder {
+		out = append(out, data.Values[i])
+	}
+	return out, nil
+}
+
+func encodeCursor(keys []string, values []any) (Cursor, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(cursorData{Keys: keys, Values: values}); err != nil {
+		return "", err
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(b.Bytes())), nil
+}
+
+func decodeCursor(c Cursor) (cursorData, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return cursorData{}, err
+	}
+	var data cursorData
+	err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&data)
+	return data, err
+}
+
+// validCursor checks a decoded Cursor before its values are bound, since it comes from the caller. It must be for the
+// same key columns, and there must be a value for each one that a driver could have returned for a column that
+// isn't NULL.
+func validCursor(data cursorData, keyNames []string) bool {
+	if !slices.Equal(data.Keys, keyNames) || len(data.Values) != len(keyNames) {
+		return false
+	}
+	for _, v := range data.Values {
+		if v == nil || !driver.IsValue(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// captureKeys wraps a mapper.Builder so that the values of the key columns in the most recently mapped row are
+// stored in last.
+func captureKeys(builder mapper.Builder, keys []keyColumn, last *[]any) mapper.Builder {
+	return func(cols []string, vals []any) (any, error) {
+		out, err := builder(cols, vals)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, len(keys))
+		for i, k := range keys {
+			pos := slices.Index(cols, k.name)
+			if pos == -1 {
+				return nil, QueryError{Kind: MissingKeyColumn, Name: k.name}
+			}
+			//every value is scanned into an *any
+			values[i] = *(vals[pos].(*any))
+		}
+		*last = values
+		return out, nil
+	}
+}
+
+// makeCursorImplementation implements a Querier function that returns a slice, a Cursor for the last row in the
+// slice, and an error.
+func makeCursorImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo, opts options) (func(args []reflect.Value) []reflect.Value, error) {
+	if len(opts.keyColumns) == 0 {
+		return nil, QueryError{Kind: NoKeyColumns, Name: funcType.String()}
+	}
+	keys, err := parseKeyColumns(opts.keyColumns)
+	if err != nil {
+		return nil, err
+	}
+	names := keyNames(keys)
+	sType := funcType.Out(0)
+	builder, err := mapper.MakeBuilder(ctx, sType)
+	if err != nil {
+		return nil, err
+	}
+	eType := funcType.Out(2)
+	buildRetVals := func(items any, c Cursor, err error) []reflect.Value {
+		itemsVal := reflect.Zero(sType)
+		if items != nil {
+			itemsVal = reflect.ValueOf(items)
+		}
+		errVal := errZero
+		if err != nil {
+			errVal = reflect.ValueOf(err).Convert(eType)
+		}
+		return []reflect.Value{itemsVal, reflect.ValueOf(c), errVal}
+	}
+	hasContext := funcType.In(0).Implements(contextType)
+	return func(args []reflect.Value) []reflect.Value {
+		ctx := ctx
+		if hasContext {
+			ctx = args[0].Interface().(context.Context)
+		}
+		finalQuery, err := query.finalize(ctx, args)
+		if err != nil {
+			return buildRetVals(nil, "", err)
+		}
+		queryArgs, err := buildQueryArgs(ctx, args, paramOrder)
+		if errors.Is(err, errSkipQuery) {
+			return buildRetVals(nil, "", nil)
+		}
+		if err != nil {
+			return buildRetVals(nil, "", err)
+		}
+		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
+		var rows *sql.Rows
+		if hasContext {
+			rows, err = args[1].Interface().(ContextQuerier).QueryContext(ctx, finalQuery, queryArgs...)
+		} else {
+			rows, err = args[0].Interface().(Querier).Query(finalQuery, queryArgs...)
+		}
+		if err != nil {
+			return buildRetVals(nil, "", err)
+		}
+		var last []any
+		items, err := handleMapping(ctx, sType, rows, captureKeys(builder, keys, &last))
+		if err != nil {
+			return buildRetVals(nil, "", err)
+		}
+		var c Cursor
+		if last != nil {
+			c, err = encodeCursor(names, last)
+		}
+		return buildRetVals(items, c, err)
+	}, nil
+}
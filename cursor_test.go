@@ -0,0 +1,245 @@
+package proteus
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseKeyColumns(t *testing.T) {
+	keys, err := parseKeyColumns([]string{"-created_at=p.created_at", " -id "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []keyColumn{{name: "created_at", expr: "p.created_at", desc: true}, {name: "id", expr: "id", desc: true}}
+	if diff := cmp.Diff(expected, keys, cmp.AllowUnexported(keyColumn{})); diff != "" {
+		t.Error(diff)
+	}
+	for _, v := range [][]string{{"a", "-b"}, {""}, {"a="}} {
+		if _, err := parseKeyColumns(v); !errors.Is(err, QueryError{Kind: InvalidKeyColumns}) {
+			t.Errorf("%v: expected InvalidKeyColumns, got %v", v, err)
+		}
+	}
+}
+
+func TestCursorPredicate(t *testing.T) {
+	ctx := context.Background()
+	var f func(Querier, string, Cursor)
+	nameOrderMap := map[string]int{"name": 1, "after": 2}
+	query := "select * from foo where name = :name: and :after: order by a, b, c"
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c, err := encodeCursor([]string{"a", "b", "c"}, []any{created, int64(7), "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		name      string
+		pa        Dialect
+		keys      []string
+		cursor    Cursor
+		query     string
+		queryArgs []any
+	}{
+		{
+			name:      "empty cursor",
+			pa:        PostgresDialect,
+			keys:      []string{"a", "b", "c"},
+			query:     "select * from foo where name = $1 and 1 = 1 order by a, b, c",
+			queryArgs: []any{"bob"},
+		},
+		{
+			name:      "row values",
+			pa:        PostgresDialect,
+			keys:      []string{"a", "b", "c=f.c"},
+			cursor:    c,
+			query:     "select * from foo where name = $1 and (a, b, f.c) > ($2, $3, $4) order by a, b, c",
+			queryArgs: []any{"bob", created, int64(7), "x"},
+		},
+		{
+			name:      "numbered without row values",
+			pa:        OracleDialect,
+			keys:      []string{"-a", "-b", "-c"},
+			cursor:    c,
+			query:     "select * from foo where name = :1 and (a < :2 OR (a = :2 AND b < :3) OR (a = :2 AND b = :3 AND c < :4)) order by a, b, c",
+			queryArgs: []any{"bob", created, int64(7), "x"},
+		},
+		{
+			name:      "question marks without row values",
+			pa:        ParamAdapter(func(int) string { return "?" }),
+			keys:      []string{"a", "b", "c"},
+			cursor:    c,
+			query:     "select * from foo where name = ? and (a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?)) order by a, b, c",
+			queryArgs: []any{"bob", created, created, int64(7), created, int64(7), "x"},
+		},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			q, qps, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, reflect.TypeOf(f), v.pa, options{keyColumns: v.keys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := []reflect.Value{{}, reflect.ValueOf("bob"), reflect.ValueOf(v.cursor)}
+			finalQuery, err := q.finalize(ctx, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if finalQuery != v.query {
+				t.Errorf("expected %s, got %s", v.query, finalQuery)
+			}
+			queryArgs, err := buildQueryArgs(ctx, args, qps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(v.queryArgs, queryArgs); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	q, qps, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{keyColumns: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []reflect.Value{{}, reflect.ValueOf("bob"), reflect.ValueOf(c)}
+	if _, err := q.finalize(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+	// the cursor has three values, but there are only two key columns
+	if _, err = buildQueryArgs(ctx, args, qps); !errors.Is(err, QueryError{Kind: InvalidCursor}) {
+		t.Errorf("expected InvalidCursor, got %v", err)
+	}
+	// a cursor comes from the caller, so it's checked before its values are bound
+	for _, v := range []struct {
+		name   string
+		keys   []string
+		values []any
+	}{
+		{"other key columns", []string{"b", "a"}, []any{int64(1), "x"}},
+		{"not a driver value", []string{"a", "b"}, []any{1, "x"}},
+		{"null", []string{"a", "b"}, []any{nil, "x"}},
+		{"too few values", []string{"a", "b"}, []any{"x"}},
+	} {
+		bad, err := encodeCursor(v.keys, v.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := []reflect.Value{{}, reflect.ValueOf("bob"), reflect.ValueOf(bad)}
+		if _, err = buildQueryArgs(ctx, args, qps); !errors.Is(err, QueryError{Kind: InvalidCursor}) {
+			t.Errorf("%s: expected InvalidCursor, got %v", v.name, err)
+		}
+	}
+	if _, err = buildQueryArgs(ctx, []reflect.Value{{}, reflect.ValueOf("bob"), reflect.ValueOf(Cursor("not a cursor"))}, qps); !errors.Is(err, QueryError{Kind: InvalidCursor}) {
+		t.Errorf("expected InvalidCursor, got %v", err)
+	}
+	_, _, err = buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+	if !errors.Is(err, QueryError{Kind: NoKeyColumns}) {
+		t.Errorf("expected NoKeyColumns, got %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	ctx := context.Background()
+	type item struct {
+		Id   int64  `prof:"id"`
+		Name string `prof:"name"`
+	}
+	type s struct {
+		List func(ctx context.Context, q ContextQuerier, after Cursor) ([]item, Cursor, error) `proq:"select id, name from foo where :after: order by name, id limit 2" prop:"after" prokey:"name,id"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	conn := &pageConn{
+		columns: [][]string{{"id", "name"}, {"id", "name"}, {"id", "name"}},
+		results: [][][]driver.Value{{{int64(3), "al"}, {int64(1), "bob"}}, {{int64(2), "cy"}}, {}},
+	}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+
+	var all []item
+	var after Cursor
+	for i := 0; i < 3; i++ {
+		items, next, err := sImpl.List(ctx, db, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, items...)
+		after = next
+	}
+	if after != "" {
+		t.Errorf("expected an empty cursor after the last page, got %s", after)
+	}
+	if diff := cmp.Diff([]item{{3, "al"}, {1, "bob"}, {2, "cy"}}, all); diff != "" {
+		t.Error(diff)
+	}
+	expectedQueries := []string{
+		"select id, name from foo where 1 = 1 order by name, id limit 2",
+		"select id, name from foo where (name, id) > ($1, $2) order by name, id limit 2",
+		"select id, name from foo where (name, id) > ($1, $2) order by name, id limit 2",
+	}
+	if diff := cmp.Diff(expectedQueries, conn.queries); diff != "" {
+		t.Error(diff)
+	}
+	if conn.args[1][0].Value != "bob" || conn.args[1][1].Value != int64(1) || conn.args[2][0].Value != "cy" {
+		t.Errorf("unexpected args %v", conn.args)
+	}
+
+	// the key columns can be marked in the prof struct tags instead
+	type keyed struct {
+		Id   int64  `prof:"id,key"`
+		Name string `prof:"name"`
+	}
+	type tagged struct {
+		List func(ctx context.Context, q ContextQuerier, after Cursor) ([]keyed, Cursor, error) `proq:"select id, name from foo where :after: order by id limit 2" prop:"after"`
+	}
+	taggedImpl := tagged{}
+	if err := ShouldBuild(ctx, &taggedImpl, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	conn = &pageConn{
+		columns: [][]string{{"id", "name"}, {"id", "name"}},
+		results: [][][]driver.Value{{{int64(1), "al"}, {int64(2), "bob"}}, {}},
+	}
+	db2 := sql.OpenDB(conn)
+	defer db2.Close()
+	_, next, err := taggedImpl.List(ctx, db2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = taggedImpl.List(ctx, db2, next); err != nil {
+		t.Fatal(err)
+	}
+	if conn.queries[1] != "select id, name from foo where id > $1 order by id limit 2" || conn.args[1][0].Value != int64(2) {
+		t.Errorf("unexpected query %v with args %v", conn.queries, conn.args)
+	}
+	// a cursor from a function with other key columns isn't accepted
+	other, err := encodeCursor([]string{"name", "id"}, []any{"bob", int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = taggedImpl.List(ctx, db2, other); !errors.Is(err, QueryError{Kind: InvalidCursor}) {
+		t.Errorf("expected InvalidCursor, got %v", err)
+	}
+
+	type badReturn struct {
+		List func(ctx context.Context, q ContextQuerier, after Cursor) (item, Cursor, error) `proq:"select id, name from foo where :after:" prop:"after" prokey:"id"`
+	}
+	err = ShouldBuild(ctx, &badReturn{}, Postgres)
+	if !errors.Is(err, ValidationError{Kind: CursorReturnType}) {
+		t.Errorf("expected CursorReturnType, got %v", err)
+	}
+	type noKeys struct {
+		List func(ctx context.Context, q ContextQuerier) ([]item, Cursor, error) `proq:"select id, name from foo"`
+	}
+	err = ShouldBuild(ctx, &noKeys{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: NoKeyColumns}) {
+		t.Errorf("expected NoKeyColumns, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package proteus
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// buildDefaults finds the parameters that have a default, written as name=value in the prop struct tag or the names
+// passed to BuildFunction. It returns the text of the default for each name.
+func buildDefaults(names []string) map[string]string {
+	var out map[string]string
+	for _, v := range names {
+		_, value, ok := strings.Cut(v, "=")
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[propName(v)] = strings.TrimSpace(value)
+	}
+	return out
+}
+
+// parseDefaults converts the default for each parameter into a value of the parameter's type, keyed by the position
+// of the parameter. Only a parameter that can be nil can have a default, since nil is the only value that means the
+// caller didn't provide one.
+func parseDefaults(funcType reflect.Type, nameOrderMap map[string]int, defaults map[string]string) (map[int]reflect.Value, error) {
+	out := make(map[int]reflect.Value, len(defaults))
+	for name, text := range defaults {
+		pos, ok := nameOrderMap[name]
+		if !ok || pos >= funcType.NumIn() {
+			return nil, QueryError{Kind: ParameterNotFound, Name: name}
+		}
+		if !isNillable(funcType.In(pos)) {
+			return nil, QueryError{Kind: InvalidDefault, Name: name, Value: text, TypeKind: funcType.In(pos).String()}
+		}
+		val, ok := parseDefault(funcType.In(pos), text)
+		if !ok {
+			return nil, QueryError{Kind: InvalidDefault, Name: name, Value: text, TypeKind: funcType.In(pos).String()}
+		}
+		out[pos] = val
+	}
+	return out, nil
+}
+
+// parseDefault converts the text of a default into a value of type t. It supports strings, numbers, bools, types
+// that implement encoding.TextUnmarshaler, and pointers to any of them.
+func parseDefault(t reflect.Type, text string) (reflect.Value, bool) {
+	if t.Kind() == reflect.Pointer {
+		elem, ok := parseDefault(t.Elem(), text)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(elem)
+		return p, true
+	}
+	v := reflect.New(t).Elem()
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return v, u.UnmarshalText([]byte(text)) == nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, t.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetBool(b)
+	default:
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// isNillable reports whether a value of type t can be nil.
+func isNillable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return true
+	}
+	return false
+}
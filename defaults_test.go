@@ -0,0 +1,109 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaults(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		List func(ctx context.Context, e ContextExecutor, name string, limit *int, status *string, since *time.Time) (int64, error) `proq:"update foo set a = 1 where name = :name: and status = :status: and created > :since: limit :limit:" prop:"name, limit = 50, status=active,since=2024-01-02T00:00:00Z"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	if _, err := sImpl.List(ctx, re, "", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// a pointer to a zero value is provided, so it keeps its value
+	zero := 0
+	empty := ""
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := sImpl.List(ctx, re, "bob", &zero, &empty, &since); err != nil {
+		t.Fatal(err)
+	}
+	fifty := 50
+	active := "active"
+	defaultSince := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	expected := [][]any{
+		{"", &active, &defaultSince, &fifty},
+		{"bob", &empty, &since, &zero},
+	}
+	if diff := cmp.Diff(expected, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	var f func(ctx context.Context, e ContextExecutor, ids []int, page *int) (int64, error)
+	b := NewBuilder(MySQL)
+	err := b.BuildFunction(ctx, &f, "update foo set a = 1 where id in (:ids:)[[ limit 10 offset :page: ]]", []string{"ids", "page=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = f(ctx, re, []int{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the fragment is decided by what was passed in, not by the default
+	page := 0
+	if _, err = f(ctx, re, []int{1, 2}, &page); err != nil {
+		t.Fatal(err)
+	}
+	expectedQueries := []string{
+		"update foo set a = 1 where id in (?, ?)",
+		"update foo set a = 1 where id in (?, ?) limit 10 offset ? ",
+	}
+	if diff := cmp.Diff(expectedQueries, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{1, 2}, {1, 2, &page}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// a default outside of a fragment is bound when nothing is passed in
+	var g func(ctx context.Context, e ContextExecutor, limit *int, offset *int) (int64, error)
+	err = b.BuildFunction(ctx, &g, "update foo set a = 1 limit :limit:[[ offset :offset: ]]", []string{"limit=50", "offset=10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = g(ctx, re, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"update foo set a = 1 limit ?"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{&fifty}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	type badDefault struct {
+		F func(ctx context.Context, e ContextExecutor, limit *int) (int64, error) `proq:"update foo set a = 1 limit :limit:" prop:"limit=lots"`
+	}
+	err = ShouldBuild(ctx, &badDefault{}, Postgres)
+	var qe QueryError
+	if !errors.As(err, &qe) || qe.Kind != InvalidDefault || qe.Name != "limit" || qe.Value != "lots" || qe.TypeKind != "*int" {
+		t.Errorf("Expected InvalidDefault error, got %v", err)
+	}
+	// zero is a value the caller can pass in, so it can't mean that a default is wanted
+	type notNillable struct {
+		F func(ctx context.Context, e ContextExecutor, limit int) (int64, error) `proq:"update foo set a = 1 limit :limit:" prop:"limit=50"`
+	}
+	err = ShouldBuild(ctx, &notNillable{}, Postgres)
+	if !errors.As(err, &qe) || qe.Kind != InvalidDefault || qe.Name != "limit" || qe.TypeKind != "int" {
+		t.Errorf("Expected InvalidDefault error, got %v", err)
+	}
+	type badType struct {
+		F func(ctx context.Context, e ContextExecutor, ids []int) (int64, error) `proq:"update foo set a = 1 where id in (:ids:)" prop:"ids=1"`
+	}
+	err = ShouldBuild(ctx, &badType{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidDefault}) {
+		t.Errorf("Expected InvalidDefault error, got %v", err)
+	}
+}
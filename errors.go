@@ -22,6 +22,9 @@ const (
 	RowsMustBeNonNil                          // "rows must be non-nil"
 	NoValuesFromQuery                         // "no values returned from query"
 	ShouldNeverGetHere                        // "should never get here"
+	ChunkedReturnType                         // "the 1st output parameter of a Querier that splits its query into chunks must be a slice"
+	CursorReturnType                          // "a function that returns a Cursor must be a Querier that returns a slice, a Cursor, and an error, and can't split its query into chunks"
+	PageResultReturnType                      // "a function must return a PageResult as a value, not a pointer"
 )
 
 var validationMessages = map[ValidationErrorKind]string{
@@ -39,6 +42,9 @@ var validationMessages = map[ValidationErrorKind]string{
 	RowsMustBeNonNil:      "rows must be non-nil",
 	NoValuesFromQuery:     "no values returned from query",
 	ShouldNeverGetHere:    "should never get here",
+	ChunkedReturnType:     "the 1st output parameter of a Querier that splits its query into chunks must be a slice",
+	CursorReturnType:      "a function that returns a Cursor must be a Querier that returns a slice, a Cursor, and an error, and can't split its query into chunks",
+	PageResultReturnType:  "a function must return a PageResult as a value, not a pointer",
 }
 
 // ValidationError is returned when a struct, function signature, or type passed
@@ -77,6 +83,39 @@ const (
 	ParameterNotFound                   // Name: the parameter name
 	NilParameterPath                    // Name: the parameter name
 	InvalidParameterType                // Name: the parameter name; TypeKind: the actual kind
+	UnterminatedLiteral                 // Query: the full query string; Position: byte offset where the literal or comment starts
+	MissingClosingBrace                 // Query: the full query string
+	UnknownOption                       // Name: the unrecognized entry in the proopt struct tag
+	ChunkNotSupported                   // Name: the slice parameter names, or the Page parameter name
+	EmptySlice                          // Name: the slice parameter name
+	InvalidRows                         // Name: the rows variable
+	UnclosedFragment                    // Query: the full query string; Position: byte offset of the [[
+	EmptyFragment                       // Query: the full query string; Position: byte offset of the [[
+	IncludeNotFound                     // Name: the name of the included query
+	IncludeCycle                        // Name: the chain of included query names
+	InvalidAllowlist                    // Name: the invalid entry in the proid struct tag
+	NoAllowlist                         // Name: the dynamic identifier variable name
+	IdentifierNotAllowed                // Name: the dynamic identifier variable name; Value: the rejected value
+	InvalidColumns                      // Name: the invalid entry in the prosort or profilter struct tag
+	NoSortColumns                       // Name: the Sort variable name
+	UnknownSortKey                      // Name: the Sort variable name; Value: the unknown key
+	InvalidPage                         // Name: the Page variable name
+	InvalidKeyColumns                   // Name: the key columns
+	NoKeyColumns                        // Name: the Cursor variable name or function type
+	MissingKeyColumn                    // Name: the key column that isn't in the result of the query
+	InvalidCursor                       // Name: the Cursor variable name
+	NoFilterColumns                     // Name: the Filter variable name
+	UnknownFilterField                  // Name: the Filter variable name; Value: the unknown field
+	InvalidFilter                       // Name: the Filter variable name; Value: the operator or field of the invalid condition
+	UnknownTransform                    // Name: the variable name; Value: the unknown transform
+	TransformNotAllowed                 // Name: the variable name
+	InvalidTransformType                // Name: the variable name; Value: the transform; TypeKind: the kind of the value
+	UnknownContextValue                 // Name: the context variable name
+	NoContextParameter                  // Name: the context variable name
+	MissingContextValue                 // Name: the context variable name
+	InvalidDefault                      // Name: the parameter name; Value: the default; TypeKind: the type of the parameter
+	InvalidNamespace                    // Name: the namespace parameter name, or the parameter names if more than one is marked
+	UnbindableType                      // Name: the variable name; TypeKind: the type at the end of its path
 )
 
 // QueryError is returned when a query string or its parameters cannot be
@@ -84,9 +123,10 @@ const (
 type QueryError struct {
 	Kind     QueryErrorKind
 	Name     string // query or parameter name
-	Query    string // full query string (MissingClosingColon)
-	Position int    // byte offset (EmptyVariable)
-	TypeKind string // reflect.Kind string (InvalidParameterType)
+	Query    string // full query string (MissingClosingColon, UnterminatedLiteral, MissingClosingBrace, UnclosedFragment, EmptyFragment)
+	Position int    // byte offset (EmptyVariable, UnterminatedLiteral, UnclosedFragment, EmptyFragment)
+	TypeKind string // reflect.Kind string (InvalidParameterType, InvalidTransformType), or the type (InvalidDefault, UnbindableType)
+	Value    string // the rejected value (IdentifierNotAllowed, UnknownSortKey, UnknownFilterField, InvalidFilter, UnknownTransform, InvalidTransformType, InvalidDefault)
 }
 
 func (e QueryError) Error() string {
@@ -103,6 +143,72 @@ func (e QueryError) Error() string {
 		return fmt.Sprintf("query parameter %s has a path, but the incoming parameter is nil", e.Name)
 	case InvalidParameterType:
 		return fmt.Sprintf("query parameter %s has a path, but the incoming parameter is not a map or a struct it is %s", e.Name, e.TypeKind)
+	case MissingClosingBrace:
+		return fmt.Sprintf("missing a closing } somewhere: %s", e.Query)
+	case UnknownOption:
+		return fmt.Sprintf("unknown option %s in proopt struct tag", e.Name)
+	case ChunkNotSupported:
+		return fmt.Sprintf("cannot split query into chunks on %s; chunking requires exactly one slice, it must be a function parameter, and there can't be a Page", e.Name)
+	case EmptySlice:
+		return fmt.Sprintf("slice parameter %s is empty", e.Name)
+	case InvalidRows:
+		return fmt.Sprintf("%s must list one or more columns from the same slice parameter", e.Name)
+	case UnclosedFragment:
+		return fmt.Sprintf("missing a closing ]] for the fragment at position %d: %s", e.Position, e.Query)
+	case EmptyFragment:
+		return fmt.Sprintf("the fragment at position %d must refer to at least one variable: %s", e.Position, e.Query)
+	case IncludeNotFound:
+		return fmt.Sprintf("no query found for include {{> %s}}", e.Name)
+	case IncludeCycle:
+		return fmt.Sprintf("queries include each other in a cycle: %s", e.Name)
+	case InvalidAllowlist:
+		return fmt.Sprintf("invalid entry %s in proid struct tag; it must look like name=value1|value2", e.Name)
+	case NoAllowlist:
+		return fmt.Sprintf("no allowed values were declared for the dynamic identifier %s", e.Name)
+	case IdentifierNotAllowed:
+		return fmt.Sprintf("%q is not an allowed value for the dynamic identifier %s", e.Value, e.Name)
+	case InvalidColumns:
+		return fmt.Sprintf("invalid entry %s in prosort or profilter struct tag; it must look like key=column", e.Name)
+	case NoSortColumns:
+		return fmt.Sprintf("no sort columns were declared for the Sort parameter %s", e.Name)
+	case UnknownSortKey:
+		return fmt.Sprintf("%q is not a sort key for %s", e.Value, e.Name)
+	case InvalidPage:
+		return fmt.Sprintf("the Page parameter %s must be non-nil and have a Size of at least 1", e.Name)
+	case InvalidKeyColumns:
+		return fmt.Sprintf("invalid key columns %s; every key column needs a name, and they must all sort in the same direction", e.Name)
+	case NoKeyColumns:
+		return fmt.Sprintf("no key columns were declared for the Cursor in %s", e.Name)
+	case MissingKeyColumn:
+		return fmt.Sprintf("key column %s is not in the result of the query", e.Name)
+	case InvalidCursor:
+		return fmt.Sprintf("the Cursor parameter %s is not valid for this query", e.Name)
+	case NoFilterColumns:
+		return fmt.Sprintf("no filter columns were declared for the Filter parameter %s", e.Name)
+	case UnknownFilterField:
+		return fmt.Sprintf("%q is not a filter field for %s", e.Value, e.Name)
+	case InvalidFilter:
+		return fmt.Sprintf("invalid condition %q in the Filter parameter %s; a condition needs a field and an operator (with a slice for in), or a non-empty And or Or, but not both", e.Value, e.Name)
+	case UnknownTransform:
+		return fmt.Sprintf("%q is not a transform, in the variable %s", e.Value, e.Name)
+	case TransformNotAllowed:
+		return fmt.Sprintf("the variable %s can't have transforms; only a variable that is bound as a single parameter can", e.Name)
+	case InvalidTransformType:
+		return fmt.Sprintf("the transform %s can't be applied to the value of %s, which has kind %s", e.Value, e.Name, e.TypeKind)
+	case UnknownContextValue:
+		return fmt.Sprintf("no context key was registered for the variable %s", e.Name)
+	case NoContextParameter:
+		return fmt.Sprintf("the variable %s refers to the context, but the function's first parameter isn't a context.Context", e.Name)
+	case MissingContextValue:
+		return fmt.Sprintf("the value for the variable %s is not in the context", e.Name)
+	case InvalidDefault:
+		return fmt.Sprintf("the default %q for the parameter %s can't be used; the parameter must be a pointer, map, slice, or interface, and the default must convert to %s", e.Value, e.Name, e.TypeKind)
+	case InvalidNamespace:
+		return fmt.Sprintf("invalid namespace parameter in %s; only one parameter can be marked with *, and it must be a struct or a map with string keys", e.Name)
+	case UnbindableType:
+		return fmt.Sprintf("the variable %s has type %s, which can't be bound as a parameter; it must be a bool, a number, a string, a []byte, a time.Time, or a driver.Valuer", e.Name, e.TypeKind)
+	case UnterminatedLiteral:
+		return fmt.Sprintf("unterminated string, quoted identifier, or comment at position %d: %s", e.Position, e.Query)
 	default:
 		return "unknown query error"
 	}
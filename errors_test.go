@@ -31,6 +31,8 @@ func TestValidationErrorMessage(t *testing.T) {
 		{NeedExecutorOrQuerier, "need to supply an Executor or Querier parameter"},
 		{InvalidFirstParam, "first parameter must be of type context.Context, Executor, or Querier"},
 		{RowsMustBeNonNil, "rows must be non-nil"},
+		{CursorReturnType, "a function that returns a Cursor must be a Querier that returns a slice, a Cursor, and an error, and can't split its query into chunks"},
+		{PageResultReturnType, "a function must return a PageResult as a value, not a pointer"},
 	}
 	for _, c := range cases {
 		e := ValidationError{Kind: c.kind}
@@ -66,6 +68,39 @@ func TestQueryErrorMessages(t *testing.T) {
 		{QueryError{Kind: ParameterNotFound, Name: "p"}, "query parameter p cannot be found in the incoming parameters"},
 		{QueryError{Kind: NilParameterPath, Name: "p"}, "query parameter p has a path, but the incoming parameter is nil"},
 		{QueryError{Kind: InvalidParameterType, Name: "p", TypeKind: "int"}, "query parameter p has a path, but the incoming parameter is not a map or a struct it is int"},
+		{QueryError{Kind: MissingClosingBrace, Query: "select #{a"}, "missing a closing } somewhere: select #{a"},
+		{QueryError{Kind: UnterminatedLiteral, Query: "select 'a", Position: 7}, "unterminated string, quoted identifier, or comment at position 7: select 'a"},
+		{QueryError{Kind: UnknownOption, Name: "chunky"}, "unknown option chunky in proopt struct tag"},
+		{QueryError{Kind: EmptySlice, Name: "ids"}, "slice parameter ids is empty"},
+		{QueryError{Kind: UnclosedFragment, Query: "a [[ b", Position: 2}, "missing a closing ]] for the fragment at position 2: a [[ b"},
+		{QueryError{Kind: EmptyFragment, Query: "a [[ b ]]", Position: 2}, "the fragment at position 2 must refer to at least one variable: a [[ b ]]"},
+		{QueryError{Kind: IncludeNotFound, Name: "cols"}, "no query found for include {{> cols}}"},
+		{QueryError{Kind: IncludeCycle, Name: "a -> b -> a"}, "queries include each other in a cycle: a -> b -> a"},
+		{QueryError{Kind: InvalidAllowlist, Name: "table"}, "invalid entry table in proid struct tag; it must look like name=value1|value2"},
+		{QueryError{Kind: NoAllowlist, Name: "table"}, "no allowed values were declared for the dynamic identifier table"},
+		{QueryError{Kind: IdentifierNotAllowed, Name: "table", Value: "users"}, `"users" is not an allowed value for the dynamic identifier table`},
+		{QueryError{Kind: InvalidColumns, Name: "name"}, "invalid entry name in prosort or profilter struct tag; it must look like key=column"},
+		{QueryError{Kind: NoSortColumns, Name: "sort"}, "no sort columns were declared for the Sort parameter sort"},
+		{QueryError{Kind: UnknownSortKey, Name: "sort", Value: "password"}, `"password" is not a sort key for sort`},
+		{QueryError{Kind: InvalidPage, Name: "page"}, "the Page parameter page must be non-nil and have a Size of at least 1"},
+		{QueryError{Kind: InvalidKeyColumns, Name: "a,-b"}, "invalid key columns a,-b; every key column needs a name, and they must all sort in the same direction"},
+		{QueryError{Kind: NoKeyColumns, Name: "after"}, "no key columns were declared for the Cursor in after"},
+		{QueryError{Kind: MissingKeyColumn, Name: "id"}, "key column id is not in the result of the query"},
+		{QueryError{Kind: InvalidCursor, Name: "after"}, "the Cursor parameter after is not valid for this query"},
+		{QueryError{Kind: NoFilterColumns, Name: "filter"}, "no filter columns were declared for the Filter parameter filter"},
+		{QueryError{Kind: UnknownFilterField, Name: "filter", Value: "password"}, `"password" is not a filter field for filter`},
+		{QueryError{Kind: InvalidFilter, Name: "filter", Value: ">="}, `invalid condition ">=" in the Filter parameter filter; a condition needs a field and an operator (with a slice for in), or a non-empty And or Or, but not both`},
+		{QueryError{Kind: UnknownTransform, Name: "name", Value: "lowercase"}, `"lowercase" is not a transform, in the variable name`},
+		{QueryError{Kind: TransformNotAllowed, Name: "sort"}, "the variable sort can't have transforms; only a variable that is bound as a single parameter can"},
+		{QueryError{Kind: InvalidTransformType, Name: "id", Value: "lower", TypeKind: "int"}, "the transform lower can't be applied to the value of id, which has kind int"},
+		{QueryError{Kind: UnknownContextValue, Name: "ctx.tenant"}, "no context key was registered for the variable ctx.tenant"},
+		{QueryError{Kind: NoContextParameter, Name: "ctx.tenant"}, "the variable ctx.tenant refers to the context, but the function's first parameter isn't a context.Context"},
+		{QueryError{Kind: MissingContextValue, Name: "ctx.tenant"}, "the value for the variable ctx.tenant is not in the context"},
+		{QueryError{Kind: InvalidNamespace, Name: "*p,*q"}, "invalid namespace parameter in *p,*q; only one parameter can be marked with *, and it must be a struct or a map with string keys"},
+		{QueryError{Kind: UnbindableType, Name: "p.Address", TypeKind: "proteus.Address"}, "the variable p.Address has type proteus.Address, which can't be bound as a parameter; it must be a bool, a number, a string, a []byte, a time.Time, or a driver.Valuer"},
+		{QueryError{Kind: InvalidDefault, Name: "limit", Value: "lots", TypeKind: "*int"}, `the default "lots" for the parameter limit can't be used; the parameter must be a pointer, map, slice, or interface, and the default must convert to *int`},
+		{QueryError{Kind: InvalidRows, Name: "rows(p.Id, q.Id)"}, "rows(p.Id, q.Id) must list one or more columns from the same slice parameter"},
+		{QueryError{Kind: ChunkNotSupported, Name: "ids, names"}, "cannot split query into chunks on ids, names; chunking requires exactly one slice, it must be a function parameter, and there can't be a Page"},
 	}
 	for _, c := range cases {
 		if c.err.Error() != c.want {
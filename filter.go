@@ -0,0 +1,174 @@
+package proteus
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FilterOp is a comparison in a Filter. Only the FilterOp constants are allowed.
+type FilterOp string
+
+// The comparisons that can be used in a Filter.
+const (
+	Eq     FilterOp = "="
+	NotEq  FilterOp = "<>"
+	Lt     FilterOp = "<"
+	Gt     FilterOp = ">"
+	Like   FilterOp = "like"
+	In     FilterOp = "in"
+	IsNull FilterOp = "is null"
+)
+
+var filterOps = []FilterOp{Eq, NotEq, Lt, Gt, Like, In, IsNull}
+
+// Filter is a parameter type that builds the conditions of a where clause at runtime. A query refers to a Filter
+// like any other variable, as in where :filter:. A Filter either compares a field to a value, or combines other
+// Filters with AND or OR; use Where, And, and Or to make them. Each field is replaced with the column expression that
+// it maps to, declared with WithFilterColumns or the profilter struct tag, and each value is bound as a parameter, so
+// nothing in a Filter is ever written into the query as is. A field without a mapping, or an operator that isn't one
+// of the FilterOp constants, is rejected with a QueryError before the query is run.
+//
+// The zero Filter matches every row.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	// Value is ignored for IsNull, and must be a slice for In.
+	Value any
+	And   []Filter
+	Or    []Filter
+}
+
+// Where returns a Filter that compares a field to a value.
+func Where(field string, op FilterOp, value any) Filter {
+	return Filter{Field: field, Op: op, Value: value}
+}
+
+// And returns a Filter that matches the rows that match all of filters.
+func And(filters ...Filter) Filter {
+	return Filter{And: filters}
+}
+
+// Or returns a Filter that matches the rows that match any of filters.
+func Or(filters ...Filter) Filter {
+	return Filter{Or: filters}
+}
+
+func (f Filter) isEmpty() bool {
+	return f.Field == "" && len(f.And) == 0 && len(f.Or) == 0
+}
+
+var filterType = reflect.TypeFor[Filter]()
+
+// buildFilterParamInfo makes sure that a Filter variable has columns that its fields map to.
+func buildFilterParamInfo(id string, paramPos int, opts options) (paramInfo, error) {
+	if len(opts.filterColumns) == 0 {
+		return paramInfo{}, QueryError{Kind: NoFilterColumns, Name: id}
+	}
+	return paramInfo{name: id, posInParams: paramPos, filterColumns: opts.filterColumns}, nil
+}
+
+// preparedFilter is a Filter that has been checked, along with the columns for its fields.
+type preparedFilter struct {
+	name    string
+	filter  Filter
+	columns map[string]string
+}
+
+// filterValue returns the Filter for a variable. A nil *Filter is the same as the zero Filter.
+func filterValue(val any, v paramInfo) preparedFilter {
+	pf := preparedFilter{name: v.name, columns: v.filterColumns}
+	if rv := reflect.Indirect(reflect.ValueOf(val)); rv.IsValid() {
+		pf.filter = rv.Interface().(Filter)
+	}
+	return pf
+}
+
+// filterFactory returns the template function that writes out a Filter, using join for the placeholders.
+func filterFactory(join func(string, int) string) func(string, preparedFilter) (string, error) {
+	return func(key string, pf preparedFilter) (string, error) {
+		count := 0
+		text, _, err := pf.render(func(n int) string {
+			count++
+			return join(key+"#"+strconv.Itoa(count), n)
+		})
+		return text, err
+	}
+}
+
+// args returns the values for the placeholders in a Filter, in the order that they are written out.
+func (pf preparedFilter) args() ([]any, error) {
+	_, values, err := pf.render(func(int) string {
+		return ""
+	})
+	return values, err
+}
+
+// render writes out the SQL for a Filter. placeholder is called with the number of placeholders to write out for
+// each value, or for each slice of values.
+func (pf preparedFilter) render(placeholder func(int) string) (string, []any, error) {
+	if pf.filter.isEmpty() {
+		return "1 = 1", nil, nil
+	}
+	var values []any
+	var b strings.Builder
+	var walk func(f Filter) error
+	walk = func(f Filter) error {
+		switch {
+		case f.Field != "" && len(f.And) == 0 && len(f.Or) == 0:
+			column, ok := pf.columns[f.Field]
+			if !ok {
+				return QueryError{Kind: UnknownFilterField, Name: pf.name, Value: f.Field}
+			}
+			if !slices.Contains(filterOps, f.Op) {
+				return QueryError{Kind: InvalidFilter, Name: pf.name, Value: string(f.Op)}
+			}
+			b.WriteString(column)
+			b.WriteString(" ")
+			b.WriteString(string(f.Op))
+			switch f.Op {
+			case IsNull:
+				//no value
+			case In:
+				rv := reflect.ValueOf(f.Value)
+				if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+					return QueryError{Kind: InvalidFilter, Name: pf.name, Value: string(f.Op)}
+				}
+				b.WriteString(" (")
+				b.WriteString(placeholder(rv.Len()))
+				b.WriteString(")")
+				for i := 0; i < rv.Len(); i++ {
+					values = append(values, rv.Index(i).Interface())
+				}
+			default:
+				b.WriteString(" ")
+				b.WriteString(placeholder(1))
+				values = append(values, f.Value)
+			}
+		case f.Field == "" && (len(f.And) == 0) != (len(f.Or) == 0):
+			filters, sep := f.And, " AND "
+			if len(f.Or) > 0 {
+				filters, sep = f.Or, " OR "
+			}
+			b.WriteString("(")
+			for i, v := range filters {
+				if i > 0 {
+					b.WriteString(sep)
+				}
+				if err := walk(v); err != nil {
+					return err
+				}
+			}
+			b.WriteString(")")
+		default:
+			//a Filter can only do one thing
+			return QueryError{Kind: InvalidFilter, Name: pf.name, Value: f.Field}
+		}
+		return nil
+	}
+	if err := walk(pf.filter); err != nil {
+		return "", nil, err
+	}
+	return b.String(), values, nil
+}
@@ -0,0 +1,115 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Update func(ctx context.Context, e ContextExecutor, status string, filter Filter) (int64, error) `proq:"update foo set status = :status: where :filter: and status <> :status:" prop:"status,filter" profilter:"name=f.name,cost=f.cost"`
+		Search func(ctx context.Context, e ContextExecutor, filter *Filter) (int64, error)               `proq:"update foo set a = 1[[ where :filter:]]" prop:"filter"`
+	}
+	filter := And(
+		Where("name", Like, "b%"),
+		Or(Where("cost", Lt, 10), Where("cost", IsNull, nil), Where("id", In, []int{1, 2, 3})),
+	)
+	data := []struct {
+		name  string
+		pa    ParamAdapter
+		query string
+		args  []any
+	}{
+		{
+			name:  "numbered",
+			pa:    Postgres,
+			query: "update foo set status = $1 where (f.name like $2 AND (f.cost < $3 OR f.cost is null OR f.id in ($4, $5, $6))) and status <> $1",
+			args:  []any{"done", "b%", 10, 1, 2, 3},
+		},
+		{
+			name:  "question marks",
+			pa:    MySQL,
+			query: "update foo set status = ? where (f.name like ? AND (f.cost < ? OR f.cost is null OR f.id in (?, ?, ?))) and status <> ?",
+			args:  []any{"done", "b%", 10, 1, 2, 3, "done"},
+		},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			sImpl := s{}
+			if err := ShouldBuild(ctx, &sImpl, v.pa, WithFilterColumns(map[string]string{"id": "f.id"})); err != nil {
+				t.Fatal(err)
+			}
+			re := &recordingExecutor{}
+			if _, err := sImpl.Update(ctx, re, "done", filter); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{v.query}, re.Queries); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff([][]any{v.args}, re.Args); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres, WithFilterColumns(map[string]string{"id": "f.id"})); err != nil {
+		t.Fatal(err)
+	}
+	re := &recordingExecutor{}
+	single := Where("id", Eq, 5)
+	if _, err := sImpl.Search(ctx, re, &single); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sImpl.Search(ctx, re, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sImpl.Search(ctx, re, &Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sImpl.Update(ctx, re, "done", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"update foo set a = 1 where f.id = $1",
+		"update foo set a = 1",
+		"update foo set a = 1",
+		"update foo set status = $1 where 1 = 1 and status <> $1",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+
+	// bad filters never reach the database
+	re = &recordingExecutor{}
+	bad := []struct {
+		filter Filter
+		kind   QueryErrorKind
+	}{
+		{Where("password", Eq, "x"), UnknownFilterField},
+		{Where("name", "= 1 or 1 =", "x"), InvalidFilter},
+		{Where("id", In, 1), InvalidFilter},
+		{Filter{Field: "name", Op: Eq, And: []Filter{Where("id", Eq, 1)}}, InvalidFilter},
+		{Or(Where("id", Eq, 1), And()), InvalidFilter},
+	}
+	for _, v := range bad {
+		if _, err := sImpl.Update(ctx, re, "done", v.filter); !errors.Is(err, QueryError{Kind: v.kind}) {
+			t.Errorf("%v: expected %v, got %v", v.filter, v.kind, err)
+		}
+	}
+	if len(re.Queries) != 0 {
+		t.Errorf("Expected no queries, got %v", re.Queries)
+	}
+
+	type noColumns struct {
+		F func(ctx context.Context, e ContextExecutor, filter Filter) (int64, error) `proq:"update foo set a = 1 where :filter:" prop:"filter"`
+	}
+	err := ShouldBuild(ctx, &noColumns{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: NoFilterColumns}) {
+		t.Errorf("Expected NoFilterColumns error, got %v", err)
+	}
+}
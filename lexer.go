@@ -0,0 +1,249 @@
+package proteus
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	paramToken
+	fragmentStartToken
+	fragmentEndToken
+)
+
+// queryToken is either a run of SQL text that is copied into the final query as-is, the body of a
+// variable that needs to be replaced with a placeholder, or the start or end of a conditional fragment.
+type queryToken struct {
+	kind  tokenKind
+	value string
+	pos   int // byte offset of the token in the original query
+}
+
+// lexQuery splits a proq query into SQL text and variables written in the specified syntax. Variables are only recognized outside of
+// single-quoted strings, double-quoted and backquoted identifiers, dollar-quoted bodies, line and block
+// comments. A :: is treated as a Postgres cast and never starts a variable. Conditional fragments start with [[
+// and end with ]]; a ]] outside of a fragment is left alone. If there is an error, the tokens found before it are
+// returned along with it.
+//
+// escapes:
+// \ (any character), that character literally (meant for escaping : and \)
+// ending on a single \ means the \ is ignored
+func lexQuery(query string, syntax ParamSyntax) ([]queryToken, error) {
+	l := lexer{query: query}
+	for l.pos < len(query) {
+		c := query[l.pos]
+		switch {
+		case c == '\\':
+			l.escape()
+		case c == '\'' || c == '"' || c == '`':
+			start := l.pos
+			l.copyByte()
+			if !l.copyUntil(string(c)) {
+				return l.fail(QueryError{Kind: UnterminatedLiteral, Query: query, Position: start})
+			}
+		case strings.HasPrefix(query[l.pos:], "--"):
+			// a line comment can end the query, so there's no error if the newline isn't found
+			l.copyUntil("\n")
+		case strings.HasPrefix(query[l.pos:], "/*"):
+			start := l.pos
+			l.copyBytes(2)
+			if !l.copyUntil("*/") {
+				return l.fail(QueryError{Kind: UnterminatedLiteral, Query: query, Position: start})
+			}
+		case c == '$':
+			tag, ok := l.dollarTag()
+			if !ok {
+				l.copyByte()
+				continue
+			}
+			start := l.pos
+			l.copyBytes(len(tag))
+			if !l.copyUntil(tag) {
+				return l.fail(QueryError{Kind: UnterminatedLiteral, Query: query, Position: start})
+			}
+		case strings.HasPrefix(query[l.pos:], "[["):
+			l.fragments = append(l.fragments, l.pos)
+			l.addMarker(fragmentStartToken)
+		case len(l.fragments) > 0 && strings.HasPrefix(query[l.pos:], "]]"):
+			l.fragments = l.fragments[:len(l.fragments)-1]
+			l.addMarker(fragmentEndToken)
+		case c == ':' && strings.HasPrefix(query[l.pos:], "::"):
+			l.copyBytes(2)
+		case c == ':' && syntax == ColonDelimited:
+			start := l.pos
+			end := strings.IndexByte(query[start+1:], ':')
+			if end == -1 {
+				return l.fail(QueryError{Kind: MissingClosingColon, Query: query})
+			}
+			end += start + 1
+			if end == start+1 {
+				//error! must have a something
+				return l.fail(QueryError{Kind: EmptyVariable, Position: end})
+			}
+			l.addParam(query[start+1:end], start, end+1)
+		case c == ':' && syntax == ColonPrefixed, c == '@' && syntax == AtPrefixed:
+			if c == '@' && strings.HasPrefix(query[l.pos:], "@@") {
+				// MySQL system variable
+				l.copyBytes(2)
+				continue
+			}
+			end := l.pos + 1 + prefixedNameLen(query[l.pos+1:])
+			if end == l.pos+1 {
+				// not followed by a name, so it's not a variable
+				l.copyByte()
+				continue
+			}
+			if query[l.pos+1:end] == "rows" && strings.HasPrefix(query[end:], "(") {
+				// a batch of rows includes its column list
+				if closer := strings.IndexByte(query[end:], ')'); closer != -1 {
+					end += closer + 1
+				}
+			}
+			l.addParam(query[l.pos+1:end], l.pos, end)
+		case c == '#' && syntax == HashBraced && strings.HasPrefix(query[l.pos:], "#{"):
+			start := l.pos
+			end := strings.IndexByte(query[start+2:], '}')
+			if end == -1 {
+				return l.fail(QueryError{Kind: MissingClosingBrace, Query: query})
+			}
+			end += start + 2
+			if end == start+2 {
+				return l.fail(QueryError{Kind: EmptyVariable, Position: end})
+			}
+			l.addParam(query[start+2:end], start, end+1)
+		default:
+			l.copyByte()
+		}
+	}
+	if len(l.fragments) > 0 {
+		return l.fail(QueryError{Kind: UnclosedFragment, Query: query, Position: l.fragments[len(l.fragments)-1]})
+	}
+	l.flush()
+	return l.tokens, nil
+}
+
+type lexer struct {
+	query     string
+	pos       int
+	text      strings.Builder
+	textStart int
+	tokens    []queryToken
+	fragments []int // positions of the fragments that haven't been closed yet
+}
+
+// fail returns the tokens found before the error, so that problems earlier in the query are reported first.
+func (l *lexer) fail(err error) ([]queryToken, error) {
+	l.flush()
+	return l.tokens, err
+}
+
+// addParam adds the variable found between start and end (exclusive), whose name is value.
+func (l *lexer) addParam(value string, start int, end int) {
+	l.flush()
+	l.tokens = append(l.tokens, queryToken{kind: paramToken, value: value, pos: start})
+	l.pos = end
+	l.textStart = end
+}
+
+// addMarker adds the start or end of a conditional fragment, both of which are two bytes long.
+func (l *lexer) addMarker(kind tokenKind) {
+	l.flush()
+	l.tokens = append(l.tokens, queryToken{kind: kind, value: l.query[l.pos : l.pos+2], pos: l.pos})
+	l.pos += 2
+	l.textStart = l.pos
+}
+
+func (l *lexer) copyByte() {
+	l.text.WriteByte(l.query[l.pos])
+	l.pos++
+}
+
+func (l *lexer) copyBytes(n int) {
+	l.text.WriteString(l.query[l.pos : l.pos+n])
+	l.pos += n
+}
+
+// escape writes the rune after a \ without the \.
+func (l *lexer) escape() {
+	l.pos++
+	if l.pos >= len(l.query) {
+		return
+	}
+	_, size := utf8.DecodeRuneInString(l.query[l.pos:])
+	l.copyBytes(size)
+}
+
+// copyUntil copies text up to and including closer, honoring \ escapes along the way.
+// It returns false if the end of the query is reached first.
+func (l *lexer) copyUntil(closer string) bool {
+	for l.pos < len(l.query) {
+		if l.query[l.pos] == '\\' {
+			l.escape()
+			continue
+		}
+		if strings.HasPrefix(l.query[l.pos:], closer) {
+			l.copyBytes(len(closer))
+			return true
+		}
+		l.copyByte()
+	}
+	return false
+}
+
+// dollarTag returns the opening tag of a Postgres dollar-quoted string ($$ or $name$) that starts at the
+// current position, if there is one.
+func (l *lexer) dollarTag() (string, bool) {
+	// a $ inside an identifier (legal in Postgres) can't start a dollar-quoted string
+	if l.pos > 0 && isIdentByte(l.query[l.pos-1]) {
+		return "", false
+	}
+	for i := l.pos + 1; i < len(l.query); i++ {
+		c := l.query[i]
+		if c == '$' {
+			return l.query[l.pos : i+1], true
+		}
+		// tags follow the rules for identifiers, so they can't start with a digit ($1 is a positional parameter)
+		if !isIdentByte(c) || (i == l.pos+1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func (l *lexer) flush() {
+	if l.text.Len() > 0 {
+		l.tokens = append(l.tokens, queryToken{kind: textToken, value: l.text.String(), pos: l.textStart})
+		l.text.Reset()
+	}
+	l.textStart = l.pos
+}
+
+// prefixedNameLen returns the length of the variable name at the start of s for the prefixed syntaxes. Names are
+// identifiers, optionally starting with a $, separated by periods. A trailing period isn't part of the name. A name
+// can start with a # to mark it as a dynamic identifier, and a period can follow a ? that marks a nil-safe path.
+func prefixedNameLen(s string) int {
+	i := 0
+	if strings.HasPrefix(s, "#") {
+		if len(s) == 1 || (s[1] != '$' && !isIdentByte(s[1])) {
+			return 0
+		}
+		i++
+	}
+	if i < len(s) && s[i] == '$' {
+		i++
+	}
+	for i < len(s) && (isIdentByte(s[i]) || (s[i] == '.' && i+1 < len(s) && isIdentByte(s[i+1]))) {
+		i++
+		if i+2 < len(s) && s[i] == '?' && s[i+1] == '.' && isIdentByte(s[i+2]) {
+			i++
+		}
+	}
+	return i
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= utf8.RuneSelf
+}
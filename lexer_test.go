@@ -0,0 +1,182 @@
+package proteus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLexQuery(t *testing.T) {
+	text := func(s string) queryToken {
+		return queryToken{kind: textToken, value: s}
+	}
+	param := func(s string) queryToken {
+		return queryToken{kind: paramToken, value: s}
+	}
+	data := []struct {
+		name   string
+		query  string
+		tokens []queryToken
+	}{
+		{
+			name:   "simple",
+			query:  "select * from foo where id = :id:",
+			tokens: []queryToken{text("select * from foo where id = "), param("id")},
+		},
+		{
+			name:   "single quotes",
+			query:  "select '10:30', 'it''s :not: a var' from foo where a = :a:",
+			tokens: []queryToken{text("select '10:30', 'it''s :not: a var' from foo where a = "), param("a")},
+		},
+		{
+			name:   "quoted identifiers",
+			query:  "select \"a:b\", `c:d` from foo where a = :a:",
+			tokens: []queryToken{text("select \"a:b\", `c:d` from foo where a = "), param("a")},
+		},
+		{
+			name:   "line comment",
+			query:  "select * from foo -- note: foo\nwhere a = :a: -- trailing: comment",
+			tokens: []queryToken{text("select * from foo -- note: foo\nwhere a = "), param("a"), text(" -- trailing: comment")},
+		},
+		{
+			name:   "block comment",
+			query:  "select /* :a: */ * from foo where a = :a:",
+			tokens: []queryToken{text("select /* :a: */ * from foo where a = "), param("a")},
+		},
+		{
+			name:   "dollar quotes",
+			query:  "select $$a:b$$, $fn$ :c: $$ $fn$ where a = :a: and b = $1",
+			tokens: []queryToken{text("select $$a:b$$, $fn$ :c: $$ $fn$ where a = "), param("a"), text(" and b = $1")},
+		},
+		{
+			name:   "casts",
+			query:  "select id::text from foo where a = :a:::int",
+			tokens: []queryToken{text("select id::text from foo where a = "), param("a"), text("::int")},
+		},
+		{
+			name:   "json literal",
+			query:  `select '{"a": {"b": ":c:"}}'::jsonb where a = :a:`,
+			tokens: []queryToken{text(`select '{"a": {"b": ":c:"}}'::jsonb where a = `), param("a")},
+		},
+		{
+			name:  "fragments",
+			query: "select * from foo where a[b[1]] = 1 [[ and b = :b: [[ and c = ':]]' ]]]] '[[x'",
+			tokens: []queryToken{
+				text("select * from foo where a[b[1]] = 1 "), {kind: fragmentStartToken, value: "[["}, text(" and b = "), param("b"), text(" "),
+				{kind: fragmentStartToken, value: "[["}, text(" and c = ':]]' "), {kind: fragmentEndToken, value: "]]"}, {kind: fragmentEndToken, value: "]]"}, text(" '[[x'"),
+			},
+		},
+		{
+			name:   "escapes",
+			query:  `select * from Pr\:oduct where name = '\:' and a = :a:`,
+			tokens: []queryToken{text(`select * from Pr:oduct where name = ':' and a = `), param("a")},
+		},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			tokens, err := lexQuery(v.query, ColonDelimited)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i := range tokens {
+				tokens[i].pos = 0
+			}
+			if diff := cmp.Diff(v.tokens, tokens, cmp.AllowUnexported(queryToken{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLexQuerySyntax(t *testing.T) {
+	text := func(s string) queryToken {
+		return queryToken{kind: textToken, value: s}
+	}
+	param := func(s string) queryToken {
+		return queryToken{kind: paramToken, value: s}
+	}
+	data := []struct {
+		name   string
+		syntax ParamSyntax
+		query  string
+		tokens []queryToken
+	}{
+		{
+			name:   "colon prefixed",
+			syntax: ColonPrefixed,
+			query:  "select * from foo where a = :p.Name and b=:$1, c = ':x' and d = e::text and f := 1 and g = :g.",
+			tokens: []queryToken{text("select * from foo where a = "), param("p.Name"), text(" and b="), param("$1"), text(", c = ':x' and d = e::text and f := 1 and g = "), param("g"), text(".")},
+		},
+		{
+			name:   "at prefixed",
+			syntax: AtPrefixed,
+			query:  "select @@version, a:b from foo where a = @p.Name and b=@$1.Id and c = '@x' and d = a @ b",
+			tokens: []queryToken{text("select @@version, a:b from foo where a = "), param("p.Name"), text(" and b="), param("$1.Id"), text(" and c = '@x' and d = a @ b")},
+		},
+		{
+			name:   "prefixed identifiers",
+			syntax: AtPrefixed,
+			query:  "select * from @#table where a = @#p.Col and b = '#' and c = @# d",
+			tokens: []queryToken{text("select * from "), param("#table"), text(" where a = "), param("#p.Col"), text(" and b = '#' and c = @# d")},
+		},
+		{
+			name:   "colon prefixed rows",
+			syntax: ColonPrefixed,
+			query:  "insert into foo(a, b) values :rows(p.A, p.B) returning id",
+			tokens: []queryToken{text("insert into foo(a, b) values "), param("rows(p.A, p.B)"), text(" returning id")},
+		},
+		{
+			name:   "prefixed nil-safe paths",
+			syntax: ColonPrefixed,
+			query:  "select * from foo where a = :p.Address?.City and b = :q? and c = :r?.",
+			tokens: []queryToken{text("select * from foo where a = "), param("p.Address?.City"), text(" and b = "), param("q"), text("? and c = "), param("r"), text("?.")},
+		},
+		{
+			name:   "hash braced",
+			syntax: HashBraced,
+			query:  "select a:b, '#{x}' from foo where a = #{p.Name} and b=#{$1}",
+			tokens: []queryToken{text("select a:b, '#{x}' from foo where a = "), param("p.Name"), text(" and b="), param("$1")},
+		},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			tokens, err := lexQuery(v.query, v.syntax)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i := range tokens {
+				tokens[i].pos = 0
+			}
+			if diff := cmp.Diff(v.tokens, tokens, cmp.AllowUnexported(queryToken{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLexQueryErrors(t *testing.T) {
+	data := []struct {
+		name   string
+		syntax ParamSyntax
+		query  string
+		err    error
+	}{
+		{"missing closing colon", ColonDelimited, "select * from foo where a = :a", QueryError{Kind: MissingClosingColon}},
+		{"unterminated string", ColonDelimited, "select 'abc from foo where a = :a:", QueryError{Kind: UnterminatedLiteral}},
+		{"unterminated identifier", ColonDelimited, "select \"abc from foo", QueryError{Kind: UnterminatedLiteral}},
+		{"unterminated comment", ColonDelimited, "select /* abc from foo", QueryError{Kind: UnterminatedLiteral}},
+		{"unterminated dollar quote", ColonDelimited, "select $x$ abc $$ from foo", QueryError{Kind: UnterminatedLiteral}},
+		{"unclosed fragment", ColonDelimited, "select * from foo where 1=1 [[ and a = :a:", QueryError{Kind: UnclosedFragment}},
+		{"missing closing brace", HashBraced, "select * from foo where a = #{a", QueryError{Kind: MissingClosingBrace}},
+		{"empty braces", HashBraced, "select * from foo where a = #{}", QueryError{Kind: EmptyVariable}},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := lexQuery(v.query, v.syntax)
+			if !errors.Is(err, v.err) {
+				t.Errorf("expected %v, got %v", v.err, err)
+			}
+		})
+	}
+}
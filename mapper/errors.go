@@ -15,20 +15,23 @@ const (
 	SubfieldOfNil                               // cannot descend into nil
 	SubfieldUnsupportedKind                     // non-map/struct/slice/array subfield
 	ValueNoPathRemaining                        // value extraction: no path left
-	ValueMapNonStringKey                        // map key is not a string
+	ValueMapNonStringKey                        // map key is not a string, an integer, or an encoding.TextUnmarshaler
 	ValueContainedNonMapStruct                  // cannot descend into non-map/struct
 	NoSuchFieldType                             // Field: struct field name not found (type extraction)
 	NoSuchMapKey                                // Key: map key not found
 	NoSuchField                                 // Field: struct field name not found (value extraction)
 	InvalidIndex                                // Index: non-integer or out-of-range index; Err: strconv error if present
+	InvalidMethod                               // Value: name of a method that can't be called in a path
+	ValueSubfieldOfNil                          // Value: the entry that can't be read because the value holding it is nil
+	InvalidMapKey                               // Value: entry that can't be converted to the map's key type; Err: the conversion error
 )
 
 // ExtractError is returned when navigating a dot-separated path through a
 // value or type fails.
 type ExtractError struct {
 	Kind  ExtractErrorKind
-	Value string // field name (NoSuchFieldType, NoSuchField, NoSuchMapKey) or index (InvalidIndex)
-	Err   error  // InvalidIndex: wrapped strconv error (may be nil)
+	Value string // field name (NoSuchFieldType, NoSuchField, NoSuchMapKey), index (InvalidIndex), method name (InvalidMethod), or entry (ValueSubfieldOfNil, InvalidMapKey)
+	Err   error  // InvalidIndex: wrapped strconv error (may be nil); InvalidMapKey: the conversion error
 }
 
 func (e ExtractError) Error() string {
@@ -42,7 +45,7 @@ func (e ExtractError) Error() string {
 	case ValueNoPathRemaining:
 		return "cannot extract value; no path remaining"
 	case ValueMapNonStringKey:
-		return "cannot extract value; map does not have a string key"
+		return "cannot extract value; map key is not a string, an integer, or an encoding.TextUnmarshaler"
 	case ValueContainedNonMapStruct:
 		return "cannot extract value; only maps and structs can have contained values"
 	case NoSuchFieldType:
@@ -56,6 +59,12 @@ func (e ExtractError) Error() string {
 			return fmt.Sprintf("invalid index: %s :%v", e.Value, e.Err)
 		}
 		return fmt.Sprintf("invalid index: %s", e.Value)
+	case InvalidMethod:
+		return "cannot call method " + e.Value + "; it must take no parameters and return one value, or a value and an error"
+	case InvalidMapKey:
+		return fmt.Sprintf("invalid map key: %s: %v", e.Value, e.Err)
+	case ValueSubfieldOfNil:
+		return "cannot extract value; the value that contains " + e.Value + " is nil"
 	default:
 		return "unknown extract error"
 	}
@@ -71,7 +80,7 @@ func (e ExtractError) Is(target error) bool {
 	return t.Kind == AnyExtract || e.Kind == t.Kind
 }
 
-// Unwrap returns the underlying strconv error for InvalidIndex, nil otherwise.
+// Unwrap returns the underlying error for InvalidIndex and InvalidMapKey, nil otherwise.
 func (e ExtractError) Unwrap() error {
 	return e.Err
 }
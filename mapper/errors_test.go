@@ -78,6 +78,9 @@ func TestExtractErrorMessages(t *testing.T) {
 		{ExtractError{Kind: NoSuchMapKey, Value: "bar"}, "cannot extract value; no such map key bar"},
 		{ExtractError{Kind: NoSuchFieldType, Value: "Baz"}, "cannot find the type; no such field Baz"},
 		{ExtractError{Kind: InvalidIndex, Value: "xyz"}, "invalid index: xyz"},
+		{ExtractError{Kind: InvalidMethod, Value: "Greet"}, "cannot call method Greet; it must take no parameters and return one value, or a value and an error"},
+		{ExtractError{Kind: ValueSubfieldOfNil, Value: "City"}, "cannot extract value; the value that contains City is nil"},
+		{ExtractError{Kind: InvalidMapKey, Value: "ten", Err: errors.New("bad")}, "invalid map key: ten: bad"},
 	}
 	for _, c := range cases {
 		if c.err.Error() != c.want {
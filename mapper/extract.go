@@ -3,12 +3,32 @@ package mapper
 import (
 	"context"
 	"database/sql/driver"
+	"encoding"
 	"log/slog"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
+// ExtractType returns the type found by following path, starting from curType. The first entry in path names
+// curType itself. Each following entry is a struct field, a map key, or a slice or array index. A map key is converted
+// to the map's key type, which can be a string, an integer, or a type that implements encoding.TextUnmarshaler. If the entry after
+// a slice or array isn't an index, the rest of the path is applied to each element, and the result is a slice of
+// the type found for the elements. If a struct has no field for an entry, or the value isn't a map, struct, slice,
+// or array, the entry can name an exported method that takes no parameters and returns a single value, or a value
+// and an error; the method's result is used in place of a field. The ? that Extract allows at the end of an entry is
+// ignored. Pointers are removed from the type at the end of the path.
 func ExtractType(ctx context.Context, curType reflect.Type, path []string) (reflect.Type, error) {
+	return extractType(ctx, curType, path, false)
+}
+
+// ExtractDeclaredType follows path the same way as ExtractType, but returns the type at the end of the path as it
+// is declared, so a field of type *T is returned as *T, not T. Use it when the methods of the type matter.
+func ExtractDeclaredType(ctx context.Context, curType reflect.Type, path []string) (reflect.Type, error) {
+	return extractType(ctx, curType, path, true)
+}
+
+func extractType(ctx context.Context, curType reflect.Type, path []string, declared bool) (reflect.Type, error) {
 	// error case path length == 0
 	if len(path) == 0 {
 		return nil, ExtractError{Kind: NoPathRemaining}
@@ -16,39 +36,83 @@ func ExtractType(ctx context.Context, curType reflect.Type, path []string) (refl
 	ss := fromPtrType(curType)
 	// base case path length == 1
 	if len(path) == 1 {
+		if declared {
+			return curType, nil
+		}
 		return ss, nil
 	}
 	// length > 1, find a match for path[1], and recurse
 	if ss == nil {
 		return nil, ExtractError{Kind: SubfieldOfNil}
 	}
+	key := entryName(path[1])
 	switch ss.Kind() {
 	case reflect.Map:
-		//give up -- we can't figure out what's in the map, so just return the type of the value
-		return ss.Elem(), nil
+		if _, err := mapKey(ss.Key(), key); err != nil {
+			return nil, err
+		}
+		//the type of what's in an interface isn't known until there's a value, so that's as far as we can go
+		if ss.Elem().Kind() == reflect.Interface {
+			return ss.Elem(), nil
+		}
+		return extractType(ctx, ss.Elem(), path[1:], declared)
 	case reflect.Struct:
 		//make sure the field exists
-		if f, exists := ss.FieldByName(path[1]); exists {
-			return ExtractType(ctx, f.Type, path[1:])
+		if f, exists := ss.FieldByName(key); exists {
+			return extractType(ctx, f.Type, path[1:], declared)
 		}
-		return nil, ExtractError{Kind: NoSuchFieldType, Value: path[1]}
+		if m, exists := reflect.PointerTo(ss).MethodByName(key); exists {
+			return extractMethodType(ctx, m, path, declared)
+		}
+		return nil, ExtractError{Kind: NoSuchFieldType, Value: key}
 	case reflect.Array, reflect.Slice:
 		// handle slices and arrays
-		_, err := strconv.Atoi(path[1])
+		if _, err := strconv.Atoi(key); err == nil {
+			return extractType(ctx, ss.Elem(), path[1:], declared)
+		}
+		// not an index, so the rest of the path is applied to every element
+		elemType, err := extractType(ctx, ss.Elem(), path, declared)
 		if err != nil {
-			return nil, ExtractError{Kind: InvalidIndex, Value: path[1], Err: err}
+			return nil, err
 		}
-		return ExtractType(ctx, ss.Elem(), path[1:])
+		return reflect.SliceOf(elemType), nil
+	case reflect.Interface:
+		return nil, ExtractError{Kind: SubfieldUnsupportedKind}
 	default:
+		if m, exists := reflect.PointerTo(ss).MethodByName(key); exists {
+			return extractMethodType(ctx, m, path, declared)
+		}
 		return nil, ExtractError{Kind: SubfieldUnsupportedKind}
 	}
 }
 
+var errorType = reflect.TypeFor[error]()
+
+// extractMethodType checks that a method can be called in a path, and follows the rest of the path from its result.
+// The method's type includes its receiver.
+func extractMethodType(ctx context.Context, m reflect.Method, path []string, declared bool) (reflect.Type, error) {
+	mt := m.Type
+	if mt.NumIn() != 1 || mt.NumOut() == 0 || mt.NumOut() > 2 || (mt.NumOut() == 2 && mt.Out(1) != errorType) {
+		return nil, ExtractError{Kind: InvalidMethod, Value: entryName(path[1])}
+	}
+	return extractType(ctx, mt.Out(0), path[1:], declared)
+}
+
+// Extract returns the value found by following path, starting from s, using the same rules as ExtractType. When
+// the path is applied to each element of a slice or array, the result is a []any holding each element's value.
+//
+// An entry in path that ends with ? makes that entry, and everything after it, nil-safe: if a nil pointer, a nil
+// map, or a missing map key is found on the rest of the path, the result is nil instead of an error.
 func Extract(ctx context.Context, s any, path []string) (any, error) {
+	return extract(ctx, s, path, false)
+}
+
+func extract(ctx context.Context, s any, path []string, nilSafe bool) (any, error) {
 	// error case path length == 0
 	if len(path) == 0 {
 		return nil, ExtractError{Kind: ValueNoPathRemaining}
 	}
+	nilSafe = nilSafe || strings.HasSuffix(path[0], "?")
 	// base case path length == 1
 	if len(path) == 1 {
 		//if this implements the driver.Valuer interface, call Value, otherwise just return it
@@ -58,49 +122,149 @@ func Extract(ctx context.Context, s any, path []string) (any, error) {
 		return s, nil
 	}
 	// length > 1, find a match for path[1], and recurse
+	key := entryName(path[1])
 	ss := fromPtr(s)
+	if ss == nil {
+		if nilSafe {
+			return nil, nil
+		}
+		return nil, ExtractError{Kind: ValueSubfieldOfNil, Value: key}
+	}
 	sv := reflect.ValueOf(ss)
 	switch sv.Kind() {
 	case reflect.Map:
-		if sv.Type().Key().Kind() != reflect.String {
-			return nil, ExtractError{Kind: ValueMapNonStringKey}
+		mk, err := mapKey(sv.Type().Key(), key)
+		if err != nil {
+			return nil, err
 		}
-		slog.DebugContext(ctx, "map extract", "key", path[1], "availableKeys", sv.MapKeys())
-		v := sv.MapIndex(reflect.ValueOf(path[1]))
+		slog.DebugContext(ctx, "map extract", "key", key, "availableKeys", sv.MapKeys())
+		v := sv.MapIndex(mk)
 		slog.DebugContext(ctx, "map extract result", "value", v)
 		if !v.IsValid() {
-			return nil, ExtractError{Kind: NoSuchMapKey, Value: path[1]}
+			if nilSafe {
+				return nil, nil
+			}
+			return nil, ExtractError{Kind: NoSuchMapKey, Value: key}
 		}
-		return Extract(ctx, v.Interface(), path[1:])
+		return extract(ctx, v.Interface(), path[1:], nilSafe)
 	case reflect.Struct:
 		//make sure the field exists
-		if _, exists := sv.Type().FieldByName(path[1]); !exists {
-			return nil, ExtractError{Kind: NoSuchField, Value: path[1]}
+		f, exists := sv.Type().FieldByName(key)
+		if !exists {
+			return extractMethod(ctx, s, path, nilSafe, ExtractError{Kind: NoSuchField, Value: key})
 		}
-
-		v := sv.FieldByName(path[1])
-		return Extract(ctx, v.Interface(), path[1:])
+		//a field promoted from a nil embedded pointer can't be read
+		v, err := sv.FieldByIndexErr(f.Index)
+		if err != nil {
+			if nilSafe {
+				return nil, nil
+			}
+			return nil, ExtractError{Kind: ValueSubfieldOfNil, Value: key}
+		}
+		return extract(ctx, v.Interface(), path[1:], nilSafe)
 	case reflect.Array, reflect.Slice:
 		// handle slices and arrays
-		pos, err := strconv.Atoi(path[1])
+		pos, err := strconv.Atoi(key)
 		if err != nil {
-			return nil, ExtractError{Kind: InvalidIndex, Value: path[1], Err: err}
+			return extractEach(ctx, sv, path, nilSafe)
 		}
 		if pos < 0 || pos >= sv.Len() {
-			return nil, ExtractError{Kind: InvalidIndex, Value: path[1]}
+			return nil, ExtractError{Kind: InvalidIndex, Value: key}
 		}
 		v := sv.Index(pos)
-		return Extract(ctx, v.Interface(), path[1:])
-	default:
+		return extract(ctx, v.Interface(), path[1:], nilSafe)
+	case reflect.Interface:
 		return nil, ExtractError{Kind: ValueContainedNonMapStruct}
+	default:
+		return extractMethod(ctx, s, path, nilSafe, ExtractError{Kind: ValueContainedNonMapStruct})
 	}
 }
 
+// extractMethod calls the method named by the next entry in path on s, and follows the rest of the path from its
+// result. A method with a pointer receiver is called on a copy of s if s isn't a pointer. If there is no such
+// method, it returns notFound.
+func extractMethod(ctx context.Context, s any, path []string, nilSafe bool, notFound error) (any, error) {
+	name := entryName(path[1])
+	v := reflect.ValueOf(s)
+	m := v.MethodByName(name)
+	if !m.IsValid() && v.Kind() != reflect.Pointer {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		m = p.MethodByName(name)
+	}
+	if !m.IsValid() {
+		return nil, notFound
+	}
+	mt := m.Type()
+	if mt.NumIn() != 0 || mt.NumOut() == 0 || mt.NumOut() > 2 || (mt.NumOut() == 2 && mt.Out(1) != errorType) {
+		return nil, ExtractError{Kind: InvalidMethod, Value: name}
+	}
+	out := m.Call(nil)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return extract(ctx, out[0].Interface(), path[1:], nilSafe)
+}
+
+// extractEach applies the rest of the path to every element in a slice or array, and returns the values in a slice.
+func extractEach(ctx context.Context, sv reflect.Value, path []string, nilSafe bool) (any, error) {
+	out := make([]any, 0, sv.Len())
+	for i := 0; i < sv.Len(); i++ {
+		v, err := extract(ctx, sv.Index(i).Interface(), path, nilSafe)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// mapKey converts an entry in a path into a key for a map whose keys are of type keyType. The key type can have an
+// underlying type that is a string or an integer, or it can implement encoding.TextUnmarshaler.
+func mapKey(keyType reflect.Type, entry string) (reflect.Value, error) {
+	k := reflect.New(keyType)
+	if u, ok := k.Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(entry)); err != nil {
+			return reflect.Value{}, ExtractError{Kind: InvalidMapKey, Value: entry, Err: err}
+		}
+		return k.Elem(), nil
+	}
+	switch keyType.Kind() {
+	case reflect.String:
+		k.Elem().SetString(entry)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(entry, 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, ExtractError{Kind: InvalidMapKey, Value: entry, Err: err}
+		}
+		k.Elem().SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(entry, 10, keyType.Bits())
+		if err != nil {
+			return reflect.Value{}, ExtractError{Kind: InvalidMapKey, Value: entry, Err: err}
+		}
+		k.Elem().SetUint(u)
+	default:
+		return reflect.Value{}, ExtractError{Kind: ValueMapNonStringKey}
+	}
+	return k.Elem(), nil
+}
+
+// entryName returns an entry in a path without the ? that marks it as nil-safe.
+func entryName(entry string) string {
+	return strings.TrimSuffix(entry, "?")
+}
+
 func fromPtr(s any) any {
 	st := reflect.TypeOf(s)
 	if st != nil && st.Kind() == reflect.Pointer {
-		sp := reflect.ValueOf(s).Elem()
-		return sp.Interface()
+		sp := reflect.ValueOf(s)
+		if sp.IsNil() {
+			return nil
+		}
+		return sp.Elem().Interface()
 	}
 	return s
 }
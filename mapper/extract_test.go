@@ -132,13 +132,73 @@ func TestExtractFail(t *testing.T) {
 	f(10, []string{"A", "B"}, ExtractError{Kind: ValueContainedNonMapStruct})
 
 	//invalid map
-	f(map[int]any{10: "Hello"}, []string{"m", "10"}, ExtractError{Kind: ValueMapNonStringKey})
+	f(map[float64]any{10: "Hello"}, []string{"m", "10"}, ExtractError{Kind: ValueMapNonStringKey})
+
+	//map key that can't be converted to the key type
+	f(map[int]any{10: "Hello"}, []string{"m", "ten"}, ExtractError{Kind: InvalidMapKey})
 
 	//no such field case
 	type Bar struct {
 		A int
 	}
 	f(Bar{A: 20}, []string{"b", "B"}, ExtractError{Kind: NoSuchField})
+
+	//no such field in the elements of a slice
+	f([]Bar{{A: 20}}, []string{"b", "B"}, ExtractError{Kind: NoSuchField})
+
+	//index out of range
+	f([]Bar{{A: 20}}, []string{"b", "1", "A"}, ExtractError{Kind: InvalidIndex})
+}
+
+func TestExtractEach(t *testing.T) {
+	ctx := context.Background()
+	type Bar struct {
+		A int
+		M map[string]string
+	}
+	bars := []*Bar{{A: 1, M: map[string]string{"k": "x"}}, {A: 2, M: map[string]string{"k": "y"}}}
+	v, err := Extract(ctx, bars, []string{"b", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []any{1, 2}) {
+		t.Errorf("Expected [1 2], got %v", v)
+	}
+	v, err = Extract(ctx, bars, []string{"b", "M", "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []any{"x", "y"}) {
+		t.Errorf("Expected [x y], got %v", v)
+	}
+	v, err = Extract(ctx, bars, []string{"b", "1", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 {
+		t.Errorf("Expected 2, got %v", v)
+	}
+
+	for _, tc := range []struct {
+		path []string
+		want reflect.Type
+	}{
+		{[]string{"b", "A"}, reflect.TypeFor[[]int]()},
+		{[]string{"b", "M", "k"}, reflect.TypeFor[[]string]()},
+		{[]string{"b", "0", "A"}, reflect.TypeFor[int]()},
+	} {
+		got, err := ExtractType(ctx, reflect.TypeOf(bars), tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, got)
+		}
+	}
+	_, err = ExtractType(ctx, reflect.TypeOf(bars), []string{"b", "C"})
+	if !errors.Is(err, ExtractError{Kind: NoSuchFieldType}) {
+		t.Errorf("Expected NoSuchFieldType, got %v", err)
+	}
 }
 
 func TestExtractType(t *testing.T) {
@@ -151,3 +211,221 @@ func TestExtractType(t *testing.T) {
 	myType, err := ExtractType(ctx, reflect.TypeOf(pp{}), []string{"p", "Name"})
 	fmt.Printf("%v, %s, %v\n", myType, myType.Kind(), err)
 }
+
+type person struct {
+	First string
+	Last  string
+	Boss  *person
+}
+
+func (p person) FullName() string {
+	return p.First + " " + p.Last
+}
+
+func (p *person) Initials() (string, error) {
+	if p.First == "" || p.Last == "" {
+		return "", errors.New("no initials")
+	}
+	return p.First[:1] + p.Last[:1], nil
+}
+
+func (p person) Greet(name string) string {
+	return "hello " + name
+}
+
+type cents int
+
+func (c cents) Dollars() float64 {
+	return float64(c) / 100
+}
+
+func TestExtractMethod(t *testing.T) {
+	ctx := context.Background()
+	type order struct {
+		Buyer person
+		Total cents
+	}
+	o := order{Buyer: person{First: "Ada", Last: "Lovelace", Boss: &person{First: "Charles", Last: "Babbage"}}, Total: 1250}
+	for _, tc := range []struct {
+		in       any
+		path     []string
+		want     any
+		wantType reflect.Type
+	}{
+		{o, []string{"o", "Buyer", "FullName"}, "Ada Lovelace", reflect.TypeFor[string]()},
+		// a pointer receiver works on a value, too
+		{o, []string{"o", "Buyer", "Initials"}, "AL", reflect.TypeFor[string]()},
+		{&o, []string{"o", "Buyer", "Boss", "Initials"}, "CB", reflect.TypeFor[string]()},
+		{o, []string{"o", "Total", "Dollars"}, 12.5, reflect.TypeFor[float64]()},
+		{[]order{o}, []string{"o", "Buyer", "FullName"}, []any{"Ada Lovelace"}, reflect.TypeFor[[]string]()},
+	} {
+		got, err := Extract(ctx, tc.in, tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, got)
+		}
+		gotType, err := ExtractType(ctx, reflect.TypeOf(tc.in), tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotType != tc.wantType {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.wantType, gotType)
+		}
+	}
+
+	// an error from the method is returned as is
+	_, err := Extract(ctx, person{}, []string{"p", "Initials"})
+	if err == nil || err.Error() != "no initials" {
+		t.Errorf("Expected the error from the method, got %v", err)
+	}
+	for _, tc := range []struct {
+		path []string
+		want error
+	}{
+		{[]string{"p", "Greet"}, ExtractError{Kind: InvalidMethod}},
+		{[]string{"p", "Nickname"}, ExtractError{Kind: NoSuchFieldType}},
+		{[]string{"p", "First", "Len"}, ExtractError{Kind: SubfieldUnsupportedKind}},
+	} {
+		_, err := ExtractType(ctx, reflect.TypeFor[person](), tc.path)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, err)
+		}
+	}
+	_, err = Extract(ctx, person{}, []string{"p", "Greet"})
+	if !errors.Is(err, ExtractError{Kind: InvalidMethod}) {
+		t.Errorf("Expected InvalidMethod, got %v", err)
+	}
+}
+
+func TestExtractNilSafe(t *testing.T) {
+	ctx := context.Background()
+	type Address struct {
+		City string
+	}
+	type Person struct {
+		*Address
+		Home  *Address
+		Attrs map[string]any
+	}
+	for _, tc := range []struct {
+		in   any
+		path []string
+		want any
+	}{
+		{Person{}, []string{"p", "Home?", "City"}, nil},
+		{Person{}, []string{"p?", "Home", "City"}, nil},
+		{Person{}, []string{"p?", "City"}, nil},
+		{Person{}, []string{"p?", "Attrs", "color"}, nil},
+		{Person{Attrs: map[string]any{}}, []string{"p", "Attrs?", "color"}, nil},
+		{(*Person)(nil), []string{"p?", "Home", "City"}, nil},
+		{[]Person{{Home: &Address{City: "Paris"}}, {}}, []string{"p?", "Home", "City"}, []any{"Paris", nil}},
+		{Person{Home: &Address{City: "Paris"}}, []string{"p", "Home?", "City"}, "Paris"},
+	} {
+		got, err := Extract(ctx, tc.in, tc.path)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.path, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, got)
+		}
+	}
+	gotType, err := ExtractType(ctx, reflect.TypeFor[Person](), []string{"p", "Home?", "City"})
+	if err != nil || gotType != reflect.TypeFor[string]() {
+		t.Errorf("Expected string, got %v, %v", gotType, err)
+	}
+	// the pointer at the end of the path is only kept by ExtractDeclaredType
+	gotType, err = ExtractType(ctx, reflect.TypeFor[[]Person](), []string{"p", "Home"})
+	if err != nil || gotType != reflect.TypeFor[[]Address]() {
+		t.Errorf("Expected []Address, got %v, %v", gotType, err)
+	}
+	gotType, err = ExtractDeclaredType(ctx, reflect.TypeFor[[]Person](), []string{"p", "Home"})
+	if err != nil || gotType != reflect.TypeFor[[]*Address]() {
+		t.Errorf("Expected []*Address, got %v, %v", gotType, err)
+	}
+
+	// without the ?, a nil along the path is an error instead of a panic
+	for _, tc := range []struct {
+		in   any
+		path []string
+		want error
+	}{
+		{Person{}, []string{"p", "Home", "City"}, ExtractError{Kind: ValueSubfieldOfNil}},
+		{Person{}, []string{"p", "City"}, ExtractError{Kind: ValueSubfieldOfNil}},
+		{Person{}, []string{"p", "Attrs", "color"}, ExtractError{Kind: NoSuchMapKey}},
+		// the entries before the ? aren't nil-safe
+		{(*Person)(nil), []string{"p", "Home?", "City"}, ExtractError{Kind: ValueSubfieldOfNil}},
+	} {
+		_, err := Extract(ctx, tc.in, tc.path)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, err)
+		}
+	}
+}
+
+type color int
+
+func (c *color) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red":
+		*c = 1
+	case "blue":
+		*c = 2
+	default:
+		return fmt.Errorf("unknown color %s", text)
+	}
+	return nil
+}
+
+func TestExtractMapKeys(t *testing.T) {
+	ctx := context.Background()
+	type region string
+	type Address struct {
+		City string
+	}
+	for _, tc := range []struct {
+		in       any
+		path     []string
+		want     any
+		wantType reflect.Type
+	}{
+		{map[int]string{10: "ten"}, []string{"m", "10"}, "ten", reflect.TypeFor[string]()},
+		{map[uint8]string{10: "ten"}, []string{"m", "10"}, "ten", reflect.TypeFor[string]()},
+		{map[region]Address{"east": {City: "Boston"}}, []string{"m", "east", "City"}, "Boston", reflect.TypeFor[string]()},
+		{map[color]int{2: 20}, []string{"m", "blue"}, 20, reflect.TypeFor[int]()},
+		{map[string]map[int]*Address{"a": {1: {City: "Paris"}}}, []string{"m", "a", "1", "City"}, "Paris", reflect.TypeFor[string]()},
+		// the type of what's in an interface isn't known until there's a value
+		{map[string]any{"a": Address{City: "Rome"}}, []string{"m", "a", "City"}, "Rome", reflect.TypeFor[any]()},
+	} {
+		got, err := Extract(ctx, tc.in, tc.path)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.path, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, got)
+		}
+		gotType, err := ExtractType(ctx, reflect.TypeOf(tc.in), tc.path)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.path, err)
+		}
+		if gotType != tc.wantType {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.wantType, gotType)
+		}
+	}
+	for _, tc := range []struct {
+		in   reflect.Type
+		path []string
+		want error
+	}{
+		{reflect.TypeFor[map[int]string](), []string{"m", "ten"}, ExtractError{Kind: InvalidMapKey}},
+		{reflect.TypeFor[map[color]string](), []string{"m", "green"}, ExtractError{Kind: InvalidMapKey}},
+		{reflect.TypeFor[map[float64]string](), []string{"m", "1"}, ExtractError{Kind: ValueMapNonStringKey}},
+		{reflect.TypeFor[map[string]Address](), []string{"m", "a", "Town"}, ExtractError{Kind: NoSuchFieldType}},
+	} {
+		_, err := ExtractType(ctx, tc.in, tc.path)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.path, tc.want, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"log/slog"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -91,7 +92,7 @@ func buildColFieldMap(sType reflect.Type, parentFieldInfo fieldInfo, colFieldMap
 			// prepend the parent struct and store off a fieldi
 			// only if this doesn't implement a scanner. If it does, then go with the scanner
 			// another special case: time.Time isn't recursed into
-			if sf.Type.Kind() == reflect.Struct && !reflect.PointerTo(sf.Type).Implements(scannerType) && sf.Type.Name() != "Time" && sf.Type.PkgPath() != "time" {
+			if isNestedStruct(sf.Type) {
 				buildColFieldMap(sf.Type, childFieldInfo, colFieldMap)
 			} else {
 				colFieldMap[strings.SplitN(tagVal, ",", 2)[0]] = childFieldInfo
@@ -114,6 +115,42 @@ func buildColFieldMap(sType reflect.Type, parentFieldInfo fieldInfo, colFieldMap
 	}
 }
 
+// isNestedStruct reports whether the columns for a field of type t come from the fields inside of it, rather than
+// the field itself. A struct that implements sql.Scanner, and time.Time, are scanned as a whole.
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(scannerType) && t.Name() != "Time" && t.PkgPath() != "time"
+}
+
+// KeyColumns returns the columns for the fields of a struct (or a pointer to one) whose prof struct tags have the key
+// option, like prof:"id,key", in the order of the fields. The fields of nested structs are included, just like they
+// are when a row is mapped.
+func KeyColumns(sType reflect.Type) []string {
+	sType = fromPtrType(sType)
+	if sType == nil || sType.Kind() != reflect.Struct {
+		return nil
+	}
+	var out []string
+	for i := 0; i < sType.NumField(); i++ {
+		sf := sType.Field(i)
+		tagVal := sf.Tag.Get("prof")
+		if tagVal == "" {
+			if sf.Type.Kind() == reflect.Struct && sf.Anonymous {
+				out = append(out, KeyColumns(sf.Type)...)
+			}
+			continue
+		}
+		if isNestedStruct(sf.Type) {
+			out = append(out, KeyColumns(sf.Type)...)
+			continue
+		}
+		name, opts, _ := strings.Cut(tagVal, ",")
+		if slices.Contains(strings.Split(opts, ","), "key") {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
 type Builder func(cols []string, vals []any) (any, error)
 
 type fieldInfo struct {
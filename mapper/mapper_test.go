@@ -0,0 +1,27 @@
+package mapper
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeyColumns(t *testing.T) {
+	type Audit struct {
+		Created time.Time `prof:"created_at,key"`
+		Updated time.Time `prof:"updated_at"`
+	}
+	type Row struct {
+		Audit
+		Name  string `prof:"name"`
+		Id    int64  `prof:"id,key"`
+		Notes string
+	}
+	if got := KeyColumns(reflect.TypeFor[*Row]()); !slices.Equal(got, []string{"created_at", "id"}) {
+		t.Errorf("expected [created_at id], got %v", got)
+	}
+	if got := KeyColumns(reflect.TypeFor[map[string]any]()); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
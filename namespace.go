@@ -0,0 +1,58 @@
+package proteus
+
+import (
+	"reflect"
+	"strings"
+)
+
+// propName returns the name of a parameter from an entry in the prop struct tag or the names passed to
+// BuildFunction, without the * that marks the namespace or the = and default that can follow it.
+func propName(entry string) string {
+	name, _, _ := strings.Cut(entry, "=")
+	return strings.TrimPrefix(strings.TrimSpace(name), "*")
+}
+
+// parseNamespace finds the parameter marked with a *, like *p, in the names of the parameters. The fields of that
+// parameter can be referred to in a query without the name of the parameter in front of them.
+func parseNamespace(names []string) (string, error) {
+	var out string
+	for _, v := range names {
+		if !strings.HasPrefix(strings.TrimSpace(v), "*") {
+			continue
+		}
+		if out != "" {
+			return "", QueryError{Kind: InvalidNamespace, Name: strings.Join(names, ",")}
+		}
+		out = propName(v)
+	}
+	return out, nil
+}
+
+// checkNamespace makes sure that the namespace parameter is a struct or a map with string keys, or a pointer to one.
+func checkNamespace(funcType posType, nameOrderMap map[string]int, namespace string) error {
+	pos, ok := nameOrderMap[namespace]
+	if !ok {
+		return QueryError{Kind: ParameterNotFound, Name: namespace}
+	}
+	t := funcType.In(pos)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Struct && (t.Kind() != reflect.Map || t.Key().Kind() != reflect.String)) {
+		return QueryError{Kind: InvalidNamespace, Name: namespace}
+	}
+	return nil
+}
+
+// qualify puts the name of the namespace parameter in front of a variable whose path doesn't start with the name of
+// a parameter.
+func qualify(id string, nameOrderMap map[string]int, namespace string) string {
+	if namespace == "" {
+		return id
+	}
+	first, _, _ := strings.Cut(id, ".")
+	if _, ok := nameOrderMap[trimNilSafe(first)]; ok {
+		return id
+	}
+	return namespace + "." + id
+}
@@ -0,0 +1,92 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jonbodner/proteus/mapper"
+)
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	type address struct {
+		City string
+	}
+	type product struct {
+		Name    string
+		Cost    float64
+		Address *address
+	}
+	type s struct {
+		Insert func(ctx context.Context, e ContextExecutor, p product) (int64, error)                     `proq:"insert into foo(name, cost, city) values(:Name:, :Cost:, :Address.City:)" prop:"*p"`
+		Update func(ctx context.Context, e ContextExecutor, id int, p product, col string) (int64, error) `proq:"update foo set :#col: = :Name:, cost = :p.Cost: where id = :id:" prop:"id, *p, col" proid:"col=name|title"`
+		Map    func(ctx context.Context, e ContextExecutor, m map[string]any) (int64, error)              `proq:"update foo set name = :name: where id = :id:" prop:"*m"`
+		Ptr    func(ctx context.Context, e ContextExecutor, p *product) (int64, error)                    `proq:"update foo set cost = :Cost: where name = :Name:" prop:"*p"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal("error while building", err)
+	}
+	var f func(ctx context.Context, e ContextExecutor, items []product) (int64, error)
+	if err := NewBuilder(MySQL).BuildFunction(ctx, &f, "insert into foo(name, cost) values :rows(Name, Cost):", []string{"*items"}); err == nil {
+		t.Error("Expected an error for a slice namespace")
+	}
+	var g func(ctx context.Context, e ContextExecutor, p product) (int64, error)
+	if err := NewBuilder(MySQL).BuildFunction(ctx, &g, "update foo set cost = :Cost: where name = :Name:", []string{"*p"}); err != nil {
+		t.Fatal(err)
+	}
+
+	re := &recordingExecutor{}
+	p := product{Name: "a", Cost: 1.5, Address: &address{City: "Boston"}}
+	for _, run := range []func() (int64, error){
+		func() (int64, error) { return sImpl.Insert(ctx, re, p) },
+		func() (int64, error) { return sImpl.Update(ctx, re, 10, p, "title") },
+		func() (int64, error) { return sImpl.Map(ctx, re, map[string]any{"name": "b", "id": 20}) },
+		func() (int64, error) { return g(ctx, re, p) },
+		func() (int64, error) { return sImpl.Ptr(ctx, re, &p) },
+	} {
+		if _, err := run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"insert into foo(name, cost, city) values($1, $2, $3)",
+		`update foo set "title" = $1, cost = $2 where id = $3`,
+		"update foo set name = $1 where id = $2",
+		"update foo set cost = ? where name = ?",
+		"update foo set cost = $1 where name = $2",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"a", 1.5, "Boston"}, {"a", 1.5, 10}, {"b", 20}, {1.5, "a"}, {1.5, "a"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+	// a nil pointer has no fields to use
+	if _, err := sImpl.Ptr(ctx, re, nil); !errors.Is(err, mapper.ExtractError{Kind: mapper.ValueSubfieldOfNil}) {
+		t.Errorf("Expected ValueSubfieldOfNil error, got %v", err)
+	}
+
+	type twoNamespaces struct {
+		F func(ctx context.Context, e ContextExecutor, p product, q product) (int64, error) `proq:"update foo set name = :Name:" prop:"*p,*q"`
+	}
+	err := ShouldBuild(ctx, &twoNamespaces{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidNamespace}) {
+		t.Errorf("Expected InvalidNamespace error, got %v", err)
+	}
+	type notStruct struct {
+		F func(ctx context.Context, e ContextExecutor, name string) (int64, error) `proq:"update foo set name = :Name:" prop:"*name"`
+	}
+	err = ShouldBuild(ctx, &notStruct{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidNamespace}) {
+		t.Errorf("Expected InvalidNamespace error, got %v", err)
+	}
+	type missingField struct {
+		F func(ctx context.Context, e ContextExecutor, p product) (int64, error) `proq:"update foo set name = :Title:" prop:"*p"`
+	}
+	if err = ShouldBuild(ctx, &missingField{}, Postgres); err == nil {
+		t.Error("Expected an error for a missing field")
+	}
+}
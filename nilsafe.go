@@ -0,0 +1,51 @@
+package proteus
+
+import (
+	"context"
+	"strings"
+)
+
+// validPath checks the path of a variable like validIdentifier, but also allows a ? at the end of any part of the
+// path except the last, like p.Address?.City. The ? makes that part of the path, and everything after it, nil-safe:
+// a nil pointer, a nil map, or a missing map key binds NULL instead of returning an error. The ? is kept in the
+// returned path, since mapper.Extract uses it.
+func validPath(ctx context.Context, value string) (string, error) {
+	parts := strings.Split(value, ".")
+	var marked []int
+	for i, v := range parts[:len(parts)-1] {
+		if name, ok := strings.CutSuffix(strings.TrimSpace(v), "?"); ok {
+			parts[i] = name
+			marked = append(marked, i)
+		}
+	}
+	id, err := validIdentifier(ctx, strings.Join(parts, "."))
+	if err != nil || len(marked) == 0 {
+		return id, err
+	}
+	idParts := strings.Split(id, ".")
+	if len(idParts) != len(parts) {
+		return "", IdentifierError{Kind: InvalidCharacterInIdentifier, Identifier: value}
+	}
+	for _, i := range marked {
+		idParts[i] += "?"
+	}
+	return strings.Join(idParts, "."), nil
+}
+
+// markNilSafe makes a whole path nil-safe when WithNilSafePaths is used, by putting a ? after the name of the
+// parameter. A path that already has a ? is left alone.
+func markNilSafe(id string, opts options) string {
+	if !opts.nilSafe || strings.Contains(id, "?") {
+		return id
+	}
+	first, rest, ok := strings.Cut(id, ".")
+	if !ok {
+		return id
+	}
+	return first + "?." + rest
+}
+
+// trimNilSafe removes the ? that marks a part of a path as nil-safe.
+func trimNilSafe(name string) string {
+	return strings.TrimSuffix(name, "?")
+}
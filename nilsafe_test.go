@@ -0,0 +1,92 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jonbodner/proteus/mapper"
+)
+
+func TestNilSafePaths(t *testing.T) {
+	ctx := context.Background()
+	type address struct {
+		City string
+	}
+	type person struct {
+		*address
+		Name  string
+		Home  *address
+		Attrs map[string]string
+	}
+	type s struct {
+		Marked func(ctx context.Context, e ContextExecutor, p person) (int64, error)    `proq:"update foo set city = :p.Home?.City:, color = :p.Attrs?.color: where name = :p.Name: [[ and home = :p.Home?.City: ]]" prop:"p"`
+		Tag    func(ctx context.Context, e ContextExecutor, p person) (int64, error)    `proq:"update foo set city = :p.Home.City:, town = :p.City: where name = :p.Name:" prop:"p" proopt:"nilsafe"`
+		Plain  func(ctx context.Context, e ContextExecutor, p person) (int64, error)    `proq:"update foo set city = :p.Home.City: where name = :p.Name:" prop:"p"`
+		Rows   func(ctx context.Context, e ContextExecutor, ps []person) (int64, error) `proq:"insert into foo(name, city) values :rows(ps.Name, ps.Home?.City):" prop:"ps"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	full := person{Name: "a", Home: &address{City: "Boston"}, Attrs: map[string]string{"color": "red"}, address: &address{City: "Salem"}}
+	for _, run := range []func() (int64, error){
+		func() (int64, error) { return sImpl.Marked(ctx, re, full) },
+		func() (int64, error) { return sImpl.Marked(ctx, re, person{Name: "b"}) },
+		func() (int64, error) { return sImpl.Tag(ctx, re, full) },
+		func() (int64, error) { return sImpl.Tag(ctx, re, person{Name: "b"}) },
+		func() (int64, error) { return sImpl.Rows(ctx, re, []person{full, {Name: "b"}}) },
+	} {
+		if _, err := run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"update foo set city = $1, color = $2 where name = $3  and home = $1 ",
+		"update foo set city = $1, color = $2 where name = $3 ",
+		"update foo set city = $1, town = $2 where name = $3",
+		"update foo set city = $1, town = $2 where name = $3",
+		"insert into foo(name, city) values ($1, $2), ($3, $4)",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	expectedArgs := [][]any{
+		{"Boston", "red", "a"},
+		{nil, nil, "b"},
+		{"Boston", "Salem", "a"},
+		{nil, nil, "b"},
+		{"a", "Boston", "b", nil},
+	}
+	if diff := cmp.Diff(expectedArgs, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// without a ?, a nil along the path is still an error
+	_, err := sImpl.Plain(ctx, re, person{Name: "b"})
+	if !errors.Is(err, mapper.ExtractError{Kind: mapper.ValueSubfieldOfNil}) {
+		t.Errorf("Expected ValueSubfieldOfNil error, got %v", err)
+	}
+
+	// the option works for functions built on their own, too
+	var f func(ctx context.Context, e ContextExecutor, p person) (int64, error)
+	if err := NewBuilder(MySQL, WithNilSafePaths()).BuildFunction(ctx, &f, "update foo set city = :p.Home.City:", []string{"p"}); err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err := f(ctx, re, person{}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]any{{nil}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// the ? can't come at the end of a path
+	var g func(ctx context.Context, e ContextExecutor, p person) (int64, error)
+	err = NewBuilder(Postgres).BuildFunction(ctx, &g, "update foo set city = #{p.Home.City?}", []string{"p"}, WithParamSyntax(HashBraced))
+	if !errors.Is(err, IdentifierError{Kind: InvalidCharacterInIdentifier}) {
+		t.Errorf("Expected InvalidCharacterInIdentifier error, got %v", err)
+	}
+}
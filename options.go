@@ -0,0 +1,321 @@
+package proteus
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ParamSyntax identifies how variables are written in a query.
+type ParamSyntax int
+
+const (
+	// ColonDelimited variables are surrounded by colons, as in :name:. This is the default.
+	ColonDelimited ParamSyntax = iota
+	// ColonPrefixed variables start with a colon and end at the first character that can't be part of a name,
+	// as in :name (the sqlx style).
+	ColonPrefixed
+	// AtPrefixed variables start with an @ and end at the first character that can't be part of a name,
+	// as in @name. A doubled @@ is left alone.
+	AtPrefixed
+	// HashBraced variables are surrounded by #{ and }, as in #{name} (the MyBatis style).
+	HashBraced
+)
+
+// EmptySlicePolicy identifies what happens when a slice that is expanded into a list of placeholders is empty.
+type EmptySlicePolicy int
+
+const (
+	// EmptySliceNull writes NULL in place of the placeholders, so that in (:ids:) becomes in (NULL) and matches no rows.
+	// This is the default.
+	EmptySliceNull EmptySlicePolicy = iota
+	// EmptySliceSkip doesn't call the database at all. The function returns the zero value for its result, or zero rows
+	// affected, and no error.
+	EmptySliceSkip
+	// EmptySliceError doesn't call the database and returns a QueryError with the EmptySlice kind instead.
+	//
+	// An empty slice after not in ( always uses EmptySliceError, whatever the policy. An empty not in matches every
+	// row, but not in (NULL) matches none, and skipping the query returns none, too.
+	EmptySliceError
+)
+
+type options struct {
+	syntax        ParamSyntax
+	arrays        bool
+	chunk         bool
+	empty         EmptySlicePolicy
+	identifiers   map[string][]string
+	sortColumns   map[string]string
+	keyColumns    []string
+	filterColumns map[string]string
+	transforms    map[string]Transform
+	contextKeys   map[string]any
+	names         []string // the entries in the prop struct tag or the names passed to BuildFunction
+	namespace     string
+	defaults      map[int]reflect.Value // the default for each parameter, by position
+	nilSafe       bool
+	dialect       Dialect
+}
+
+// Option configures how Proteus builds queries. Options can be passed to ShouldBuild, Build, and NewBuilder
+// along with any QueryMapper instances, and to the methods on Builder.
+type Option func(*options)
+
+// Map allows an Option to be passed in place of a QueryMapper. It never returns a query, and it is never called by
+// Proteus, since Options are taken out of the list of QueryMappers before any query is looked up.
+func (o Option) Map(name string) string {
+	return ""
+}
+
+// withEntries returns a copy of m with entries added to it. The maps in options are shared with any options that they
+// were copied from, so they are never modified in place.
+func withEntries[V any](m map[string]V, entries map[string]V) map[string]V {
+	out := maps.Clone(m)
+	if out == nil {
+		out = make(map[string]V, len(entries))
+	}
+	maps.Copy(out, entries)
+	return out
+}
+
+// WithDialect specifies the Dialect to use, in place of the one for the ParamAdapter passed to ShouldBuild, Build,
+// or NewBuilder. Use it to supply your own Dialect, or to change how one of the provided Dialects behaves.
+func WithDialect(d Dialect) Option {
+	return func(o *options) {
+		o.dialect = d
+	}
+}
+
+// WithParamSyntax specifies the syntax used for variables in queries.
+func WithParamSyntax(syntax ParamSyntax) Option {
+	return func(o *options) {
+		o.syntax = syntax
+	}
+}
+
+// WithArrayBinding binds a slice in an in clause as a single array parameter, rather than expanding it into one
+// parameter per element. The in clause is rewritten to use = ANY, so that in (:ids:) becomes = ANY(:ids:), and not in
+// is rewritten to use <> ALL. This keeps the text of the query the same no matter how many values are in the slice.
+// It only applies to dialects that support arrays; for other dialects, slices are still expanded.
+func WithArrayBinding() Option {
+	return func(o *options) {
+		o.arrays = true
+	}
+}
+
+// WithChunking allows a function to run its query more than once when a slice parameter has more values than the
+// dialect allows in a single statement. The slice is split into chunks and the query is run once per chunk. The
+// results are combined: slices returned by a query are concatenated, and the rows affected by an exec are added up.
+// A query that uses chunking can only refer to one slice, and it must be a function parameter. It can't have a Page
+// parameter, since each chunk would get its own page, and the combined results wouldn't be one page in the right
+// order. Since each chunk is a separate statement, use a transaction if the chunks need to succeed or fail together.
+//
+// Chunking can also be enabled for a single function field with the struct tag proopt:"chunk".
+func WithChunking() Option {
+	return func(o *options) {
+		o.chunk = true
+	}
+}
+
+// WithNilSafePaths makes every path into a parameter nil-safe, as though it were written with a ? after the name of
+// the parameter, like :p?.Address.City:. A nil pointer, a nil map, or a missing map key anywhere along the path binds
+// NULL instead of returning an error. Paths into dynamic identifiers and values from the context aren't affected.
+//
+// Nil-safe paths can also be enabled for a single function field with the struct tag proopt:"nilsafe".
+func WithNilSafePaths() Option {
+	return func(o *options) {
+		o.nilSafe = true
+	}
+}
+
+// WithEmptySlices specifies what happens when a slice parameter is empty. Without it, EmptySliceNull is used. Slices
+// that are bound as arrays (see WithArrayBinding) are never affected, since an empty array is still a valid value.
+//
+// The policy can also be set for a single function field with the struct tag proopt:"empty=null", proopt:"empty=skip",
+// or proopt:"empty=error".
+func WithEmptySlices(policy EmptySlicePolicy) Option {
+	return func(o *options) {
+		o.empty = policy
+	}
+}
+
+// WithIdentifiers declares the values that are allowed for the dynamic identifier variable called name (written
+// :#name: in a query). Each value is a table or column name, optionally qualified with a schema or table name using a
+// period. The value is quoted with the dialect's QuoteIdentifier and written directly into the query, so any value
+// that isn't on the list is rejected with a QueryError before the query is run. Calling WithIdentifiers more than
+// once for the same name adds to the list.
+//
+// The allowed values can also be declared for a single function field with the struct tag
+// proid:"table=orders|orders_archive,col=name|cost".
+func WithIdentifiers(name string, allowed ...string) Option {
+	return func(o *options) {
+		o.identifiers = withEntries(o.identifiers, map[string][]string{name: append(slices.Clone(o.identifiers[name]), allowed...)})
+	}
+}
+
+// WithSortColumns declares the column expressions that the keys in a Sort parameter map to, like
+// map[string]string{"name": "p.name", "newest": "p.created_at"}. The expressions are written into the query as they
+// are, so they must never come from user input. Calling WithSortColumns more than once adds to the mapping.
+//
+// The mapping can also be declared for a single function field with the struct tag
+// prosort:"name=p.name,newest=p.created_at".
+func WithSortColumns(columns map[string]string) Option {
+	return func(o *options) {
+		o.sortColumns = withEntries(o.sortColumns, columns)
+	}
+}
+
+// WithFilterColumns declares the column expressions that the fields in a Filter parameter can refer to, like
+// map[string]string{"name": "p.name", "cost": "p.cost"}. The expressions are written into the query as they are, so
+// they must never come from user input. Calling WithFilterColumns more than once adds to the mapping.
+//
+// The mapping can also be declared for a single function field with the struct tag profilter:"name=p.name,cost=p.cost".
+func WithFilterColumns(columns map[string]string) Option {
+	return func(o *options) {
+		o.filterColumns = withEntries(o.filterColumns, columns)
+	}
+}
+
+// WithKeyColumns declares the key columns for keyset pagination with a Cursor. Each column is the name of a column in
+// the result of the query, like created_at, in the order that the query sorts by. Start a column with a - if the
+// query sorts by it in descending order; all of the columns must be sorted in the same direction. If the column is
+// written differently in the query, add = and the expression for it, like created_at=p.created_at. Together, the
+// columns must identify a single row, and none of them can be NULL.
+//
+// The key columns can also be declared for a single function field with the struct tag prokey:"created_at,id". When
+// neither is used, the key columns are the fields of the result struct whose prof struct tags have the key option.
+func WithKeyColumns(columns ...string) Option {
+	return func(o *options) {
+		o.keyColumns = columns
+	}
+}
+
+// WithTransform registers a Transform that can be listed after the name of a variable, as in :name|slug:. A transform
+// with the same name as a built-in one replaces it. Transforms can be used with the ColonDelimited and HashBraced
+// syntaxes; with the prefixed syntaxes, a | always ends the name of a variable.
+func WithTransform(name string, t Transform) Option {
+	return func(o *options) {
+		o.transforms = withEntries(o.transforms, map[string]Transform{name: t})
+	}
+}
+
+// WithContextValue registers the key for a value in the context, so that a query can refer to it as ctx. followed by
+// name, like where tenant_id = :ctx.tenant:. The value is looked up with the key in the context that is passed to the
+// function when it is called, so it can only be used by functions whose first parameter is a context.Context, and by
+// the methods on Builder that run queries. A path after the name, like :ctx.user.ID:, is applied to the value. If the
+// value isn't in the context, the function returns a QueryError with the MissingContextValue kind instead of running
+// the query. If one of the function's parameters is called ctx, the query refers to it instead.
+func WithContextValue(name string, key any) Option {
+	return func(o *options) {
+		o.contextKeys = withEntries(o.contextKeys, map[string]any{name: key})
+	}
+}
+
+// fieldOptions returns the Options declared in the proopt, proid, prosort, profilter, and prokey struct tags on a
+// function field.
+func fieldOptions(tag reflect.StructTag) ([]Option, error) {
+	out, err := parseOptionTag(tag.Get("proopt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range strings.Split(tag.Get("proid"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(v, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.TrimSpace(values) == "" {
+			return nil, QueryError{Kind: InvalidAllowlist, Name: v}
+		}
+		allowed := strings.Split(values, "|")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+		out = append(out, WithIdentifiers(name, allowed...))
+	}
+	sortColumns, err := parseColumnsTag(tag.Get("prosort"))
+	if err != nil {
+		return nil, err
+	}
+	if len(sortColumns) > 0 {
+		out = append(out, WithSortColumns(sortColumns))
+	}
+	filterColumns, err := parseColumnsTag(tag.Get("profilter"))
+	if err != nil {
+		return nil, err
+	}
+	if len(filterColumns) > 0 {
+		out = append(out, WithFilterColumns(filterColumns))
+	}
+	if keys := tag.Get("prokey"); keys != "" {
+		out = append(out, WithKeyColumns(strings.Split(keys, ",")...))
+	}
+	return out, nil
+}
+
+// parseColumnsTag converts the value of a prosort or profilter struct tag, like name=p.name,cost=p.cost, into a map.
+func parseColumnsTag(tag string) (map[string]string, error) {
+	columns := map[string]string{}
+	for _, v := range strings.Split(tag, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		key, column, ok := strings.Cut(v, "=")
+		key, column = strings.TrimSpace(key), strings.TrimSpace(column)
+		if !ok || key == "" || column == "" {
+			return nil, QueryError{Kind: InvalidColumns, Name: v}
+		}
+		columns[key] = column
+	}
+	return columns, nil
+}
+
+var emptySlicePolicies = map[string]EmptySlicePolicy{
+	"null":  EmptySliceNull,
+	"skip":  EmptySliceSkip,
+	"error": EmptySliceError,
+}
+
+// parseOptionTag converts the value of a proopt struct tag into Options.
+func parseOptionTag(tag string) ([]Option, error) {
+	var out []Option
+	for _, v := range strings.Split(tag, ",") {
+		v = strings.TrimSpace(v)
+		switch v {
+		case "":
+			//skip
+		case "chunk":
+			out = append(out, WithChunking())
+		case "nilsafe":
+			out = append(out, WithNilSafePaths())
+		default:
+			key, value, _ := strings.Cut(v, "=")
+			policy, ok := emptySlicePolicies[value]
+			if key != "empty" || !ok {
+				return nil, QueryError{Kind: UnknownOption, Name: v}
+			}
+			out = append(out, WithEmptySlices(policy))
+		}
+	}
+	return out, nil
+}
+
+// splitOptions separates the Options from the QueryMappers and applies them, along with any extra Options,
+// on top of base.
+func splitOptions(base options, mappers []QueryMapper, extra ...Option) ([]QueryMapper, options) {
+	out := make([]QueryMapper, 0, len(mappers))
+	for _, v := range mappers {
+		if o, ok := v.(Option); ok {
+			o(&base)
+			continue
+		}
+		out = append(out, v)
+	}
+	for _, o := range extra {
+		o(&base)
+	}
+	return out, base
+}
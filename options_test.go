@@ -0,0 +1,258 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitOptions(t *testing.T) {
+	m := MapMapper{"q": "select 1"}
+	mappers, opts := splitOptions(options{}, []QueryMapper{WithChunking(), m, WithEmptySlices(EmptySliceSkip)}, WithArrayBinding())
+	// the Options are taken out, so they are never asked for a query
+	if len(mappers) != 1 || mappers[0].Map("q") != "select 1" {
+		t.Errorf("expected only the MapMapper, got %v", mappers)
+	}
+	if !opts.chunk || opts.empty != EmptySliceSkip || !opts.arrays {
+		t.Errorf("expected every Option to be applied, got %+v", opts)
+	}
+}
+
+func TestWithParamSyntax(t *testing.T) {
+	type f struct {
+		Id string
+		X  string
+	}
+	type s struct {
+		GetF   func(e Querier, id string) (f, error)                `proq:"select * from foo where id = @id" prop:"id"`
+		Update func(e Executor, id string, x string) (int64, error) `proq:"q:update" prop:"id,x"`
+	}
+	m := MapMapper{
+		"update": "update foo set x=@x, y='a:b' where id = @id",
+	}
+	sImpl := s{}
+	err := ShouldBuild(context.Background(), &sImpl, Postgres, m, WithParamSyntax(AtPrefixed))
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+
+	dummyDB := &DummyDB{
+		Queries: []string{
+			"select * from foo where id = $1",
+			"update foo set x=$1, y='a:b' where id = $2",
+		},
+		Args: [][]any{
+			{"1"},
+			{"Hello", "2"},
+		},
+	}
+
+	_, err = sImpl.GetF(dummyDB, "1")
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	_, err = sImpl.Update(dummyDB, "2", "Hello")
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestBuilderParamSyntax(t *testing.T) {
+	ctx := context.Background()
+	b := NewBuilder(Postgres, WithParamSyntax(ColonPrefixed))
+
+	var f func(e Executor, name string, age int) (int64, error)
+	err := b.BuildFunction(ctx, &f, "INSERT INTO PERSON(name, age) VALUES(:name::text, :age)", []string{"name", "age"})
+	if err != nil {
+		t.Fatalf("build function failed: %v", err)
+	}
+	// per-call options override the Builder's options
+	var g func(e Executor, name string, age int) (int64, error)
+	err = b.BuildFunction(ctx, &g, "INSERT INTO PERSON(name, age) VALUES(#{name}, #{age})", []string{"name", "age"}, WithParamSyntax(HashBraced))
+	if err != nil {
+		t.Fatalf("build function failed: %v", err)
+	}
+
+	dummyDB := &DummyDB{
+		Queries: []string{
+			"INSERT INTO PERSON(name, age) VALUES($1::text, $2)",
+			"INSERT INTO PERSON(name, age) VALUES($1, $2)",
+		},
+		Args: [][]any{
+			{"Fred", 20},
+			{"Bob", 30},
+		},
+	}
+	_, err = f(dummyDB, "Fred", 20)
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	_, err = g(dummyDB, "Bob", 30)
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestEmptySlices(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Null  func(q Querier, ids []int) ([]int, error)                              `proq:"select id from foo where id in (:ids:)" prop:"ids"`
+		Skip  func(q Querier, ids []int) ([]int, error)                              `proq:"select id from foo where id in (:ids:)" prop:"ids" proopt:"empty=skip"`
+		Error func(q Querier, ids []int) ([]int, error)                              `proq:"select id from foo where id in (:ids:)" prop:"ids" proopt:"empty=error"`
+		Del   func(ctx context.Context, e ContextExecutor, ids []int) (int64, error) `proq:"delete from foo where id in (:ids:)" prop:"ids" proopt:"empty=skip"`
+		NotIn func(ctx context.Context, e ContextExecutor, ids []int) (int64, error) `proq:"delete from foo where id NOT IN ( :ids: )" prop:"ids"`
+		Keep  func(ctx context.Context, e ContextExecutor, ids []int) (int64, error) `proq:"delete from foo where id > 0[[ and id not in (:ids:) ]]" prop:"ids"`
+		Other func(q Querier, ids []int) ([]int, error)                              `proq:"select id from foo where id not in (:ids:)" prop:"ids" proopt:"empty=skip"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(ctx, &sImpl, Postgres)
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+
+	dummyDB := &DummyDB{
+		Queries: []string{"select id from foo where id in (NULL)"},
+		Args:    [][]any{{}},
+	}
+	_, err = sImpl.Null(dummyDB, nil)
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// DummyDB returns an error for any query that isn't expected, so there's no way for these to pass if the database is called
+	dummyDB = &DummyDB{}
+	ids, err := sImpl.Skip(dummyDB, []int{})
+	if err != nil || ids != nil {
+		t.Errorf("Expected nil, nil; got %v, %v", ids, err)
+	}
+	_, err = sImpl.Error(dummyDB, []int{})
+	if !errors.Is(err, QueryError{Kind: EmptySlice}) {
+		t.Errorf("Expected EmptySlice error, got %v", err)
+	}
+	re := &recordingExecutor{}
+	count, err := sImpl.Del(ctx, re, nil)
+	if err != nil || count != 0 || len(re.Queries) != 0 {
+		t.Errorf("Expected 0, nil and no queries; got %d, %v, %v", count, err, re.Queries)
+	}
+
+	// not in (NULL) would match no rows, so an empty slice is an error instead of NULL
+	_, err = sImpl.NotIn(ctx, re, []int{})
+	if !errors.Is(err, QueryError{Kind: EmptySlice}) || len(re.Queries) != 0 {
+		t.Errorf("Expected EmptySlice error and no queries, got %v, %v", err, re.Queries)
+	}
+	// skipping would return no rows, too
+	others, err := sImpl.Other(dummyDB, []int{})
+	if !errors.Is(err, QueryError{Kind: EmptySlice}) || others != nil {
+		t.Errorf("Expected EmptySlice error, got %v, %v", others, err)
+	}
+	// a fragment drops the condition instead
+	if _, err = sImpl.Keep(ctx, re, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.NotIn(ctx, re, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"delete from foo where id > 0",
+		"delete from foo where id NOT IN ( $1, $2 )",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	re = &recordingExecutor{}
+
+	// the policy applies to ad-hoc queries, too
+	b := NewBuilder(Postgres, WithEmptySlices(EmptySliceError))
+	_, err = b.Exec(ctx, re, "delete from foo where id in (:ids:)", map[string]any{"ids": []int{}})
+	if !errors.Is(err, QueryError{Kind: EmptySlice}) {
+		t.Errorf("Expected EmptySlice error, got %v", err)
+	}
+	count, err = b.Exec(ctx, re, "delete from foo where id in (:ids:)", map[string]any{"ids": []int{}}, WithEmptySlices(EmptySliceSkip))
+	if err != nil || count != 0 || len(re.Queries) != 0 {
+		t.Errorf("Expected 0, nil and no queries; got %d, %v, %v", count, err, re.Queries)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Count func(ctx context.Context, q ContextExecutor, table string, name string) (int64, error) `proq:"delete from :#table: where name = :name:" prop:"table,name" proid:"table=orders|archive.orders"`
+		Sort  func(ctx context.Context, q ContextExecutor, p struct{ Col string }) (int64, error)    `proq:"update foo set :#p.Col: = 0" prop:"p"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(ctx, &sImpl, Postgres, WithIdentifiers("p.Col", "cost"))
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	if _, err = sImpl.Count(ctx, re, "orders", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.Count(ctx, re, "archive.orders", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.Sort(ctx, re, struct{ Col string }{"cost"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`delete from "orders" where name = $1`,
+		`delete from "archive"."orders" where name = $1`,
+		`update foo set "cost" = 0`,
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"bob"}, {"bob"}, nil}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// a value that isn't allowed never reaches the database
+	re = &recordingExecutor{}
+	_, err = sImpl.Count(ctx, re, `orders"; drop table orders; --`, "bob")
+	if !errors.Is(err, QueryError{Kind: IdentifierNotAllowed}) || len(re.Queries) != 0 {
+		t.Errorf("Expected IdentifierNotAllowed error and no queries; got %v, %v", err, re.Queries)
+	}
+
+	type noList struct {
+		F func(ctx context.Context, q ContextExecutor, table string) (int64, error) `proq:"delete from :#table:" prop:"table"`
+	}
+	err = ShouldBuild(ctx, &noList{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: NoAllowlist}) {
+		t.Errorf("Expected NoAllowlist error, got %v", err)
+	}
+	type notString struct {
+		F func(ctx context.Context, q ContextExecutor, table int) (int64, error) `proq:"delete from :#table:" prop:"table" proid:"table=orders"`
+	}
+	err = ShouldBuild(ctx, &notString{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidParameterType}) {
+		t.Errorf("Expected InvalidParameterType error, got %v", err)
+	}
+	type badTag struct {
+		F func(ctx context.Context, q ContextExecutor, table string) (int64, error) `proq:"delete from :#table:" prop:"table" proid:"table"`
+	}
+	err = ShouldBuild(ctx, &badTag{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidAllowlist}) {
+		t.Errorf("Expected InvalidAllowlist error, got %v", err)
+	}
+
+	// ad-hoc queries use the identifiers declared on the Builder or passed with the call
+	b := NewBuilder(MySQL, WithIdentifiers("table", "orders"))
+	re = &recordingExecutor{}
+	_, err = b.Exec(ctx, re, "delete from :#table: where id = :id:", map[string]any{"table": "orders", "id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Exec(ctx, re, "delete from :#table: where id = :id:", map[string]any{"table": "archive", "id": 1}, WithIdentifiers("table", "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Exec(ctx, re, "delete from :#table: where id = :id:", map[string]any{"table": "archive", "id": 1})
+	if !errors.Is(err, QueryError{Kind: IdentifierNotAllowed}) {
+		t.Errorf("Expected IdentifierNotAllowed error, got %v", err)
+	}
+	if diff := cmp.Diff([]string{"delete from `orders` where id = ?", "delete from `archive` where id = ?"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+}
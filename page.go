@@ -0,0 +1,219 @@
+package proteus
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jonbodner/proteus/mapper"
+)
+
+// Page is a parameter type that selects one page of the rows returned by a query. A query refers to a Page like any
+// other variable, usually at the end, as in select * from foo order by id :page:. The variable is replaced with the
+// dialect's syntax for skipping and limiting rows (see LimitStyle), and the size and offset are bound as parameters.
+type Page struct {
+	// Number is the 1-based number of the page. A Number less than 1 is treated as the first page.
+	Number int
+	// Size is the number of rows in a page. It must be at least 1.
+	Size int
+}
+
+// PageResult can be returned by a Querier function in place of a slice. Items holds the rows for the page, and Total
+// holds the number of rows that the query returns without any Page, found by running a second query that counts
+// them. The count query leaves off the ORDER BY at the end of the query. A PageResult must be returned as a value,
+// not a pointer.
+type PageResult[T any] struct {
+	Items []T
+	Total int64
+}
+
+func (PageResult[T]) pageResult() {}
+
+type pageResult interface {
+	pageResult()
+}
+
+var (
+	pageType       = reflect.TypeFor[Page]()
+	pageResultType = reflect.TypeFor[pageResult]()
+)
+
+// pageTemplates are formatted with the key that reports whether the page is written out, and the keys for the size
+// and offset placeholders.
+var pageTemplates = map[LimitStyle]string{
+	LimitOffset: `{{if index . %[1]q}}LIMIT {{join %[2]q 1}} OFFSET {{join %[3]q 1}}{{end}}`,
+	OffsetFetch: `{{if index . %[1]q}}OFFSET {{join %[3]q 1}} ROWS FETCH NEXT {{join %[2]q 1}} ROWS ONLY{{end}}`,
+}
+
+func addPage(name string, key string, style LimitStyle) string {
+	return fmt.Sprintf(pageTemplates[style], identifierKey(name), key+"#size", key+"#offset")
+}
+
+// pageValues returns the values for the placeholders of a Page, in the order that they are written out.
+func pageValues(val any, v paramInfo) ([]any, error) {
+	rv := reflect.Indirect(reflect.ValueOf(val))
+	if !rv.IsValid() {
+		return nil, QueryError{Kind: InvalidPage, Name: v.name}
+	}
+	page := rv.Interface().(Page)
+	if page.Size < 1 {
+		return nil, QueryError{Kind: InvalidPage, Name: v.name}
+	}
+	offset := (max(page.Number, 1) - 1) * page.Size
+	if v.limitStyle == OffsetFetch {
+		return []any{offset, page.Size}, nil
+	}
+	return []any{page.Size, offset}, nil
+}
+
+// countQuery returns a query that counts the rows returned by query when it isn't limited to a Page.
+func countQuery(query queryHolder, paramOrder []paramInfo) (queryHolder, []paramInfo) {
+	countOrder := slices.DeleteFunc(slices.Clone(paramOrder), func(v paramInfo) bool {
+		return v.page
+	})
+	if tq, ok := query.(templateQueryHolder); ok {
+		//a Page that isn't in the paramOrder isn't written out
+		tq.paramOrder = countOrder
+		query = tq
+	}
+	return countQueryHolder{query}, countOrder
+}
+
+type countQueryHolder struct {
+	queryHolder
+}
+
+func (cq countQueryHolder) finalize(ctx context.Context, args []reflect.Value) (string, error) {
+	query, err := cq.queryHolder.finalize(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return "select count(*) from (" + trimOrderBy(query) + ") proteus_count", nil
+}
+
+var (
+	orderByClause = regexp.MustCompile(`(?i)^order\s+by\b`)
+	afterOrderBy  = regexp.MustCompile(`(?i)\b(limit|offset|fetch|for)\b`)
+)
+
+// trimOrderBy removes the ORDER BY at the end of a query, since the order of the rows doesn't change how many there
+// are, and some databases, like SQL Server, don't allow an ORDER BY in a derived table. An ORDER BY inside of
+// parentheses, string literals, quoted identifiers, or comments is left alone, and so is one that is followed by
+// something that depends on the order, like a LIMIT.
+func trimOrderBy(query string) string {
+	start := -1
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end == -1 {
+				return query
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				return query
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				return query
+			}
+			i += end + 3
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || !isIdentByte(query[i-1])) && orderByClause.MatchString(query[i:]):
+			start = i
+		}
+	}
+	if start == -1 || afterOrderBy.MatchString(query[start:]) {
+		return query
+	}
+	return strings.TrimRight(query[:start], " \t\r\n")
+}
+
+// makePageResultImplementation implements a Querier function that returns a PageResult. It runs the query for the
+// items, and then a second query for the total.
+func makePageResultImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo) (func(args []reflect.Value) []reflect.Value, error) {
+	sType := funcType.Out(0)
+	itemsType := sType.Field(0).Type
+	builder, err := mapper.MakeBuilder(ctx, itemsType)
+	if err != nil {
+		return nil, err
+	}
+	countHolder, countOrder := countQuery(query, paramOrder)
+	buildRetVals := makeQuerierValueReturnVals(funcType)
+	hasContext := funcType.In(0).Implements(contextType)
+	return func(args []reflect.Value) []reflect.Value {
+		ctx := ctx
+		if hasContext {
+			ctx = args[0].Interface().(context.Context)
+		}
+		runQuery := func(query queryHolder, paramOrder []paramInfo) (*sql.Rows, error) {
+			finalQuery, err := query.finalize(ctx, args)
+			if err != nil {
+				return nil, err
+			}
+			queryArgs, err := buildQueryArgs(ctx, args, paramOrder)
+			if err != nil {
+				return nil, err
+			}
+			slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
+			if hasContext {
+				return args[1].Interface().(ContextQuerier).QueryContext(ctx, finalQuery, queryArgs...)
+			}
+			return args[0].Interface().(Querier).Query(finalQuery, queryArgs...)
+		}
+
+		rows, err := runQuery(query, paramOrder)
+		if errors.Is(err, errSkipQuery) {
+			return buildRetVals(nil, nil)
+		}
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		items, err := handleMapping(ctx, itemsType, rows, builder)
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		rows, err = runQuery(countHolder, countOrder)
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		total, err := countRows(rows)
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		result := reflect.New(sType).Elem()
+		result.Field(0).Set(reflect.ValueOf(items))
+		result.Field(1).SetInt(total)
+		return buildRetVals(result.Interface(), nil)
+	}, nil
+}
+
+// countRows reads the single value returned by a count query.
+func countRows(rows *sql.Rows) (int64, error) {
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ValidationError{Kind: NoValuesFromQuery}
+	}
+	var total int64
+	if err := rows.Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, rows.Close()
+}
@@ -0,0 +1,227 @@
+package proteus
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPage(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		F func(ctx context.Context, e ContextExecutor, name string, page Page) (int64, error) `proq:"update foo set a = 1 where name = :name: order by id :page:" prop:"name,page"`
+		G func(ctx context.Context, e ContextExecutor, page *Page) (int64, error)             `proq:"update foo set a = 1 order by id[[ :page:]]" prop:"page"`
+	}
+	data := []struct {
+		name  string
+		pa    ParamAdapter
+		page  Page
+		query string
+		args  []any
+	}{
+		{"postgres", Postgres, Page{Number: 3, Size: 20}, "update foo set a = 1 where name = $1 order by id LIMIT $2 OFFSET $3", []any{"bob", 20, 40}},
+		{"mysql first page", MySQL, Page{Size: 10}, "update foo set a = 1 where name = ? order by id LIMIT ? OFFSET ?", []any{"bob", 10, 0}},
+		{"sql server", SQLServer, Page{Number: 2, Size: 10}, "update foo set a = 1 where name = @p1 order by id OFFSET @p2 ROWS FETCH NEXT @p3 ROWS ONLY", []any{"bob", 10, 10}},
+		{"oracle", Oracle, Page{Number: 1, Size: 5}, "update foo set a = 1 where name = :1 order by id OFFSET :2 ROWS FETCH NEXT :3 ROWS ONLY", []any{"bob", 0, 5}},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			sImpl := s{}
+			if err := ShouldBuild(ctx, &sImpl, v.pa); err != nil {
+				t.Fatal(err)
+			}
+			re := &recordingExecutor{}
+			if _, err := sImpl.F(ctx, re, "bob", v.page); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{v.query}, re.Queries); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff([][]any{v.args}, re.Args); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	re := &recordingExecutor{}
+	if _, err := sImpl.G(ctx, re, nil); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"update foo set a = 1 order by id"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	_, err := sImpl.F(ctx, re, "bob", Page{Number: 1})
+	if !errors.Is(err, QueryError{Kind: InvalidPage}) {
+		t.Errorf("Expected InvalidPage error, got %v", err)
+	}
+}
+
+func TestCountQuery(t *testing.T) {
+	ctx := context.Background()
+	var f func(Querier, string, Page)
+	nameOrderMap := map[string]int{"name": 1, "page": 2}
+	q, qps, err := buildFixedQueryAndParamOrder(ctx, "select * from foo where name = :name: order by id :page:", nameOrderMap, reflect.TypeOf(f), PostgresDialect, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cq, cqps := countQuery(q, qps)
+	args := []reflect.Value{{}, reflect.ValueOf("bob"), reflect.ValueOf(Page{Number: 2, Size: 10})}
+	finalQuery, err := cq.finalize(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "select count(*) from (select * from foo where name = $1) proteus_count"; finalQuery != expected {
+		t.Errorf("expected %s, got %s", expected, finalQuery)
+	}
+	queryArgs, err := buildQueryArgs(ctx, args, cqps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{"bob"}, queryArgs); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// pageConn is a driver.Conn that returns canned rows for each query, in order.
+type pageConn struct {
+	queries []string
+	args    [][]driver.NamedValue
+	results [][][]driver.Value
+	columns [][]string
+}
+
+func (c *pageConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *pageConn) Driver() driver.Driver                        { return nil }
+func (c *pageConn) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (c *pageConn) Close() error                                 { return nil }
+func (c *pageConn) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+func (c *pageConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	i := len(c.queries)
+	c.queries = append(c.queries, query)
+	c.args = append(c.args, args)
+	return &pageRows{columns: c.columns[i], values: c.results[i]}, nil
+}
+
+type pageRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *pageRows) Columns() []string { return r.columns }
+func (r *pageRows) Close() error      { return nil }
+
+func (r *pageRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestPageResult(t *testing.T) {
+	ctx := context.Background()
+	type item struct {
+		Id   int64  `prof:"id"`
+		Name string `prof:"name"`
+	}
+	type s struct {
+		List func(ctx context.Context, q ContextQuerier, name string, page Page) (PageResult[item], error) `proq:"select id, name from foo where name = :name: order by id :page:" prop:"name,page"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	conn := &pageConn{
+		columns: [][]string{{"id", "name"}, {"count"}},
+		results: [][][]driver.Value{{{int64(3), "bob"}, {int64(4), "bob"}}, {{int64(12)}}},
+	}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+	result, err := sImpl.List(ctx, db, "bob", Page{Number: 2, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PageResult[item]{Items: []item{{3, "bob"}, {4, "bob"}}, Total: 12}
+	if diff := cmp.Diff(expected, result); diff != "" {
+		t.Error(diff)
+	}
+	expectedQueries := []string{
+		"select id, name from foo where name = $1 order by id LIMIT $2 OFFSET $3",
+		"select count(*) from (select id, name from foo where name = $1) proteus_count",
+	}
+	if diff := cmp.Diff(expectedQueries, conn.queries); diff != "" {
+		t.Error(diff)
+	}
+	if len(conn.args[0]) != 3 || len(conn.args[1]) != 1 {
+		t.Errorf("unexpected args %v", conn.args)
+	}
+}
+
+func TestPageResultSQLServer(t *testing.T) {
+	ctx := context.Background()
+	type item struct {
+		Id int64 `prof:"id"`
+	}
+	type s struct {
+		List func(ctx context.Context, q ContextQuerier, name string, page Page) (PageResult[item], error) `proq:"select id from foo where name = :name: order by id :page:" prop:"name,page"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, SQLServer); err != nil {
+		t.Fatal(err)
+	}
+	conn := &pageConn{
+		columns: [][]string{{"id"}, {"count"}},
+		results: [][][]driver.Value{{{int64(3)}}, {{int64(3)}}},
+	}
+	db := sql.OpenDB(conn)
+	defer db.Close()
+	if _, err := sImpl.List(ctx, db, "bob", Page{Number: 1, Size: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expectedQueries := []string{
+		"select id from foo where name = @p1 order by id OFFSET @p2 ROWS FETCH NEXT @p3 ROWS ONLY",
+		"select count(*) from (select id from foo where name = @p1) proteus_count",
+	}
+	if diff := cmp.Diff(expectedQueries, conn.queries); diff != "" {
+		t.Error(diff)
+	}
+
+	type pointer struct {
+		List func(ctx context.Context, q ContextQuerier, page Page) (*PageResult[item], error) `proq:"select id from foo order by id :page:" prop:"page"`
+	}
+	err := ShouldBuild(ctx, &pointer{}, Postgres)
+	if !errors.Is(err, ValidationError{Kind: PageResultReturnType}) {
+		t.Errorf("Expected PageResultReturnType error, got %v", err)
+	}
+}
+
+func TestTrimOrderBy(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"select * from foo order by id", "select * from foo"},
+		{"select * from foo ORDER\n BY id desc, name", "select * from foo"},
+		{"select * from (select * from foo order by id) f", "select * from (select * from foo order by id) f"},
+		{"select 'order by' as a, \"order by\" from foo -- order by\n", "select 'order by' as a, \"order by\" from foo -- order by\n"},
+		{"select * from foo order by id limit 10", "select * from foo order by id limit 10"},
+		{"select * from foo where a = 1 order by id for update", "select * from foo where a = 1 order by id for update"},
+		{"select reorder by from foo", "select reorder by from foo"},
+	} {
+		if got := trimOrderBy(tc.in); got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.want, got)
+		}
+	}
+}
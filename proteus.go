@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log/slog"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -69,7 +71,11 @@ func (pe Error) Unwrap() error {
 // 2. The context passed in to ShouldBuild can be used to specify the logging level used during ShouldBuild and
 // when the generated functions are invoked. This overrides any logging level specified using the SetLogLevel
 // function.
+//
+// Any Option values passed in with the QueryMappers apply to every function in the DAO.
 func ShouldBuild(ctx context.Context, dao any, paramAdapter ParamAdapter, mappers ...QueryMapper) error {
+	queryMappers, opts := splitOptions(options{}, mappers)
+	dialect := dialectFor(paramAdapter, opts)
 	daoPointerType := reflect.TypeOf(dao)
 	//must be a pointer to struct
 	if daoPointerType.Kind() != reflect.Pointer {
@@ -127,13 +133,21 @@ func ShouldBuild(ctx context.Context, dao any, paramAdapter ParamAdapter, mapper
 		}
 
 		//check to see if the query is in a QueryMapper
-		query, err = lookupQuery(query, mappers)
+		query, err = lookupQuery(query, queryMappers)
+		if err != nil {
+			out = errors.Join(out, Error{FuncName: curField.Name, FieldOrder: i, OriginalError: err})
+			continue
+		}
+
+		fieldOpts, err := fieldOptions(curField.Tag)
 		if err != nil {
 			out = errors.Join(out, Error{FuncName: curField.Name, FieldOrder: i, OriginalError: err})
 			continue
 		}
+		_, funcOpts := splitOptions(opts, nil, fieldOpts...)
+		funcOpts.names = strings.Split(paramOrder, ",")
 
-		implementation, err := makeImplementation(ctx, funcType, query, paramAdapter, nameOrderMap)
+		implementation, err := makeImplementation(ctx, funcType, query, dialect, nameOrderMap, funcOpts)
 		if err != nil {
 			out = errors.Join(out, Error{FuncName: curField.Name, FieldOrder: i, OriginalError: err})
 			continue
@@ -152,12 +166,15 @@ func ShouldBuild(ctx context.Context, dao any, paramAdapter ParamAdapter, mapper
 }
 
 // Build is the main entry point into Proteus. It takes in a pointer to a DAO struct to populate,
-// a proteus.ParamAdapter, and zero or more proteus.QueryMapper instances.
+// a proteus.ParamAdapter, and zero or more proteus.QueryMapper instances. Option values can be passed in with the
+// QueryMappers.
 //
 // As of version v0.12.0, all errors found during building will be reported back. Also, prefer using
 // proteus.ShouldBuild over proteus.Build.
 func Build(dao any, paramAdapter ParamAdapter, mappers ...QueryMapper) error {
 	ctx := context.Background()
+	queryMappers, opts := splitOptions(options{}, mappers)
+	dialect := dialectFor(paramAdapter, opts)
 	daoPointerType := reflect.TypeOf(dao)
 	//must be a pointer to struct
 	if daoPointerType.Kind() != reflect.Pointer {
@@ -215,14 +232,23 @@ func Build(dao any, paramAdapter ParamAdapter, mappers ...QueryMapper) error {
 		}
 
 		//check to see if the query is in a QueryMapper
-		query, err = lookupQuery(query, mappers)
+		query, err = lookupQuery(query, queryMappers)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping function", "function", curField.Name, "error", err)
+			outErr = errors.Join(outErr, err)
+			continue
+		}
+
+		fieldOpts, err := fieldOptions(curField.Tag)
 		if err != nil {
 			slog.WarnContext(ctx, "skipping function", "function", curField.Name, "error", err)
 			outErr = errors.Join(outErr, err)
 			continue
 		}
+		_, funcOpts := splitOptions(opts, nil, fieldOpts...)
+		funcOpts.names = strings.Split(paramOrder, ",")
 
-		implementation, err := makeImplementation(ctx, funcType, query, paramAdapter, nameOrderMap)
+		implementation, err := makeImplementation(ctx, funcType, query, dialect, nameOrderMap, funcOpts)
 		if err != nil {
 			slog.WarnContext(ctx, "skipping function", "function", curField.Name, "error", err)
 			outErr = errors.Join(outErr, err)
@@ -281,8 +307,19 @@ func validateFunction(funcType reflect.Type) (bool, error) {
 			return false, ValidationError{Kind: ChannelInputParam}
 		}
 	}
+	//a variadic parameter is passed in as a slice, so it's treated like any other slice parameter, as long as it
+	//isn't a slice of channels
+	if funcType.IsVariadic() && funcType.NumIn() > start && funcType.In(funcType.NumIn()-1).Elem().Kind() == reflect.Chan {
+		return false, ValidationError{Kind: ChannelInputParam}
+	}
 
-	//has 0, 1, or 2 return values
+	//has 0, 1, or 2 return values, or 3 if the 2nd is a Cursor
+	if funcType.NumOut() == 3 && funcType.Out(1) == cursorType {
+		if isExec || funcType.Out(0).Kind() != reflect.Slice || !funcType.Out(2).Implements(errType) {
+			return false, ValidationError{Kind: CursorReturnType}
+		}
+		return hasContext, nil
+	}
 	if funcType.NumOut() > 2 {
 		return false, ValidationError{Kind: TooManyReturnValues}
 	}
@@ -312,24 +349,61 @@ func validateFunction(funcType reflect.Type) (bool, error) {
 	return hasContext, nil
 }
 
-func makeImplementation(ctx context.Context, funcType reflect.Type, query string, paramAdapter ParamAdapter, nameOrderMap map[string]int) (func([]reflect.Value) []reflect.Value, error) {
-	fixedQuery, paramOrder, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, funcType, paramAdapter)
+func makeImplementation(ctx context.Context, funcType reflect.Type, query string, paramAdapter Dialect, nameOrderMap map[string]int, opts options) (func([]reflect.Value) []reflect.Value, error) {
+	var err error
+	opts.namespace, err = parseNamespace(opts.names)
+	if err != nil {
+		return nil, err
+	}
+	opts.defaults, err = parseDefaults(funcType, nameOrderMap, buildDefaults(opts.names))
+	if err != nil {
+		return nil, err
+	}
+	return makeQueryImplementation(ctx, funcType, query, paramAdapter, nameOrderMap, opts)
+}
+
+func makeQueryImplementation(ctx context.Context, funcType reflect.Type, query string, paramAdapter Dialect, nameOrderMap map[string]int, opts options) (func([]reflect.Value) []reflect.Value, error) {
+	if len(opts.keyColumns) == 0 {
+		//the key columns for a Cursor can be marked in the prof struct tags of the result instead
+		opts.keyColumns = resultKeyColumns(funcType)
+	}
+	fixedQuery, paramOrder, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, funcType, paramAdapter, opts)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := buildChunker(funcType, paramOrder, paramAdapter, opts)
 	if err != nil {
 		return nil, err
 	}
+	if funcType.NumOut() == 3 {
+		if chunk != nil {
+			return nil, ValidationError{Kind: CursorReturnType}
+		}
+		return makeCursorImplementation(ctx, funcType, fixedQuery, paramOrder, opts)
+	}
+	if funcType.NumOut() > 0 && funcType.Out(0).Implements(pageResultType) {
+		//a pointer has the methods of what it points to, so it implements pageResult, too
+		if funcType.Out(0).Kind() != reflect.Struct {
+			return nil, ValidationError{Kind: PageResultReturnType}
+		}
+		if chunk != nil {
+			return nil, ValidationError{Kind: ChunkedReturnType}
+		}
+		return makePageResultImplementation(ctx, funcType, fixedQuery, paramOrder)
+	}
 
 	switch fType := funcType.In(0); {
 	case fType.Implements(contextType):
 		switch fType2 := funcType.In(1); {
 		case fType2.Implements(conExType):
-			return makeContextExecutorImplementation(ctx, funcType, fixedQuery, paramOrder), nil
+			return makeContextExecutorImplementation(ctx, funcType, fixedQuery, paramOrder, chunk), nil
 		case fType2.Implements(conQType):
-			return makeContextQuerierImplementation(ctx, funcType, fixedQuery, paramOrder)
+			return makeContextQuerierImplementation(ctx, funcType, fixedQuery, paramOrder, chunk)
 		}
 	case fType.Implements(exType):
-		return makeExecutorImplementation(ctx, funcType, fixedQuery, paramOrder), nil
+		return makeExecutorImplementation(ctx, funcType, fixedQuery, paramOrder, chunk), nil
 	case fType.Implements(qType):
-		return makeQuerierImplementation(ctx, funcType, fixedQuery, paramOrder)
+		return makeQuerierImplementation(ctx, funcType, fixedQuery, paramOrder, chunk)
 	}
 	//this should be impossible, since we already validated that the first parameter is either an executor, a querier, or a context
 	return nil, ValidationError{Kind: InvalidFirstParam}
@@ -337,13 +411,50 @@ func makeImplementation(ctx context.Context, funcType reflect.Type, query string
 
 func lookupQuery(query string, mappers []QueryMapper) (string, error) {
 	if !strings.HasPrefix(query, "q:") {
-		return query, nil
+		return expandIncludes(query, mappers, nil)
 	}
 	name := query[2:]
+	q, ok := findQuery(name, mappers)
+	if !ok {
+		return "", QueryError{Kind: QueryNotFound, Name: name}
+	}
+	return expandIncludes(q, mappers, []string{name})
+}
+
+func findQuery(name string, mappers []QueryMapper) (string, bool) {
 	for _, v := range mappers {
 		if q := v.Map(name); q != "" {
-			return q, nil
+			return q, true
 		}
 	}
-	return "", QueryError{Kind: QueryNotFound, Name: name}
+	return "", false
+}
+
+var includePattern = regexp.MustCompile(`\{\{>\s*([^{}\s]+)\s*\}\}`)
+
+// expandIncludes replaces each {{> name}} in query with the query called name from the mappers, which can have
+// includes of its own. chain holds the names of the queries that are being expanded, to detect cycles.
+func expandIncludes(query string, mappers []QueryMapper, chain []string) (string, error) {
+	var outErr error
+	out := includePattern.ReplaceAllStringFunc(query, func(match string) string {
+		if outErr != nil {
+			return ""
+		}
+		name := includePattern.FindStringSubmatch(match)[1]
+		if slices.Contains(chain, name) {
+			outErr = QueryError{Kind: IncludeCycle, Name: strings.Join(append(slices.Clone(chain), name), " -> ")}
+			return ""
+		}
+		included, ok := findQuery(name, mappers)
+		if !ok {
+			outErr = QueryError{Kind: IncludeNotFound, Name: name}
+			return ""
+		}
+		included, outErr = expandIncludes(included, mappers, append(slices.Clone(chain), name))
+		return included
+	})
+	if outErr != nil {
+		return "", outErr
+	}
+	return out, nil
 }
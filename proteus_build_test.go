@@ -1,6 +1,17 @@
 package proteus
 
-import "testing"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jonbodner/proteus/mapper"
+)
 
 func TestEmbeddedNoSql(t *testing.T) {
 	type InnerEmbeddedProductDao struct {
@@ -24,3 +35,200 @@ func TestEmbeddedNoSql(t *testing.T) {
 		t.Fatal("should have populated insert")
 	}
 }
+
+func TestVariadic(t *testing.T) {
+	ctx := context.Background()
+	var dao struct {
+		Update func(ctx context.Context, e ContextExecutor, name string, ids ...int) (int64, error) `proq:"update foo set a = 1 where name = :name: and id in (:ids:)" prop:"name,ids"`
+		ByID   func(ctx context.Context, e ContextExecutor, ids ...int) (int64, error)              `proq:"update foo set a = 1 where id in (:$1:)"`
+	}
+	if err := ShouldBuild(ctx, &dao, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	var f func(ctx context.Context, e ContextExecutor, names ...string) (int64, error)
+	b := NewBuilder(MySQL)
+	if err := b.BuildFunction(ctx, &f, "update foo set a = 1 where name in (:names:)", []string{"names"}, WithEmptySlices(EmptySliceSkip)); err != nil {
+		t.Fatal(err)
+	}
+
+	re := &recordingExecutor{}
+	for _, run := range []func() (int64, error){
+		func() (int64, error) { return dao.Update(ctx, re, "a", 1, 2, 3) },
+		func() (int64, error) { return dao.Update(ctx, re, "a", []int{4, 5}...) },
+		func() (int64, error) { return dao.Update(ctx, re, "a") },
+		func() (int64, error) { return dao.ByID(ctx, re, 6, 7) },
+		func() (int64, error) { return f(ctx, re, "x", "y") },
+		// skipped, since there are no values
+		func() (int64, error) { return f(ctx, re) },
+	} {
+		if _, err := run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"update foo set a = 1 where name = $1 and id in ($2, $3, $4)",
+		"update foo set a = 1 where name = $1 and id in ($2, $3)",
+		"update foo set a = 1 where name = $1 and id in (NULL)",
+		"update foo set a = 1 where id in ($1, $2)",
+		"update foo set a = 1 where name in (?, ?)",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"a", 1, 2, 3}, {"a", 4, 5}, {"a"}, {6, 7}, {"x", "y"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+}
+
+type methodPerson struct {
+	First string
+	Last  string
+}
+
+func (p methodPerson) FullName() string {
+	return p.First + " " + p.Last
+}
+
+func TestMethodPaths(t *testing.T) {
+	ctx := context.Background()
+	var dao struct {
+		Insert func(ctx context.Context, e ContextExecutor, p methodPerson) (int64, error) `proq:"insert into person(name, initial) values(:p.FullName:, :p.First:)" prop:"p"`
+	}
+	if err := ShouldBuild(ctx, &dao, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	re := &recordingExecutor{}
+	if _, err := dao.Insert(ctx, re, methodPerson{First: "Ada", Last: "Lovelace"}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]any{{"Ada Lovelace", "Ada"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	var missing struct {
+		Insert func(ctx context.Context, e ContextExecutor, p methodPerson) (int64, error) `proq:"insert into person(name) values(:p.Nickname:)" prop:"p"`
+	}
+	err := ShouldBuild(ctx, &missing, Postgres)
+	if !errors.Is(err, mapper.ExtractError{Kind: mapper.NoSuchFieldType}) {
+		t.Errorf("Expected NoSuchFieldType error, got %v", err)
+	}
+}
+
+type region string
+
+func TestMapPaths(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Update func(ctx context.Context, e ContextExecutor, byID map[int]string, byRegion map[region][]int) (int64, error) `proq:"update foo set name = :byID.10: where id in (:byRegion.east:)" prop:"byID,byRegion"`
+	}
+	sImpl := s{}
+	if err := ShouldBuild(ctx, &sImpl, Postgres); err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	if _, err := sImpl.Update(ctx, re, map[int]string{10: "ten"}, map[region][]int{"east": {1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// slices inside of a map[string]any are expanded when the query is run
+	b := NewBuilder(Postgres)
+	filters := map[string]any{"filters": map[string]any{"ids": []int{3, 4, 5}, "name": "a", "raw": []byte("b")}}
+	if _, err := b.Exec(ctx, re, "delete from foo where id in (:filters.ids:) and name = :filters.name: and raw = :filters.raw:", filters); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"update foo set name = $1 where id in ($2, $3)",
+		"delete from foo where id in ($1, $2, $3) and name = $4 and raw = $5",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"ten", 1, 2}, {3, 4, 5, "a", []byte("b")}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+	// and they follow the policy for empty slices
+	count, err := b.Exec(ctx, re, "delete from foo where id in (:filters.ids:)", map[string]any{"filters": map[string]any{"ids": []int{}}}, WithEmptySlices(EmptySliceSkip))
+	if err != nil || count != 0 || len(re.Queries) != 2 {
+		t.Errorf("Expected 0, nil and no new queries; got %d, %v, %v", count, err, re.Queries)
+	}
+
+	type badKey struct {
+		Update func(ctx context.Context, e ContextExecutor, byID map[int]string) (int64, error) `proq:"update foo set name = :byID.ten:" prop:"byID"`
+	}
+	err = ShouldBuild(ctx, &badKey{}, Postgres)
+	if !errors.Is(err, mapper.ExtractError{Kind: mapper.InvalidMapKey}) {
+		t.Errorf("Expected InvalidMapKey error, got %v", err)
+	}
+}
+
+// ptrValuer is only a driver.Valuer through a pointer.
+type ptrValuer struct {
+	cents int64
+}
+
+func (m *ptrValuer) Value() (driver.Value, error) {
+	return m.cents, nil
+}
+
+func TestUnbindableTypes(t *testing.T) {
+	ctx := context.Background()
+	type address struct {
+		City string
+	}
+	type person struct {
+		Name    region
+		Address *address
+		Pets    []address
+		Born    *time.Time
+		Nick    sql.NullString
+		Photo   []byte
+		Attrs   map[string]any
+		Total   ptrValuer
+		Tip     *ptrValuer
+	}
+	type ok struct {
+		F func(ctx context.Context, e ContextExecutor, p person, ps []person) (int64, error) `proq:"update foo set a = :p.Name:, b = :p.Born:, c = :p.Nick:, d = :p.Photo:, e = :p.Attrs.x:, f = :p.Address|json:, g = :p.Tip: where h in (:p.Pets.City:) and i in :rows(ps.Name, ps.Born, ps.Tip):" prop:"p,ps"`
+	}
+	if err := ShouldBuild(ctx, &ok{}, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		query    string
+		name     string
+		typeName string
+	}{
+		{"update foo set a = :p.Address:", "p.Address", "*proteus.address"},
+		{"update foo set a = :p.Total:", "p.Total", "proteus.ptrValuer"},
+		{"update foo set a = 1 where b in (:ps.Total:)", "ps.Total", "proteus.ptrValuer"},
+		{"update foo set a = :p.Attrs:", "p.Attrs", "map[string]interface {}"},
+		{"update foo set a = 1 where b in (:p.Pets:)", "p.Pets", "proteus.address"},
+		{"insert into foo(a, b) values :rows(ps.Name, ps.Address):", "ps.Address", "*proteus.address"},
+		{"insert into foo(a, b) values :rows(ps.Name, ps.Total):", "ps.Total", "proteus.ptrValuer"},
+	} {
+		var f func(ctx context.Context, e ContextExecutor, p person, ps []person) (int64, error)
+		err := NewBuilder(Postgres).BuildFunction(ctx, &f, tc.query, []string{"p", "ps"})
+		var qe QueryError
+		if !errors.As(err, &qe) || qe.Kind != UnbindableType || qe.Name != tc.name || qe.TypeKind != tc.typeName {
+			t.Errorf("%s: expected UnbindableType error for %s, got %v", tc.query, tc.name, err)
+		}
+	}
+
+	// ShouldBuild names the function that has the problem
+	type bad struct {
+		Update func(ctx context.Context, e ContextExecutor, p person) (int64, error) `proq:"update foo set city = :p.Address:" prop:"p"`
+	}
+	err := ShouldBuild(ctx, &bad{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: UnbindableType}) || !strings.Contains(err.Error(), "(Update)") {
+		t.Errorf("Expected UnbindableType error for Update, got %v", err)
+	}
+
+	// the Value method of ptrValuer has a pointer receiver, so a ptrValuer value can't be bound
+	type valueReceiver struct {
+		Update func(ctx context.Context, e ContextExecutor, p person) (int64, error) `proq:"update foo set total = :p.Total:" prop:"p"`
+	}
+	err = ShouldBuild(ctx, &valueReceiver{}, Postgres)
+	var qe QueryError
+	if !errors.As(err, &qe) || qe.Kind != UnbindableType || qe.Name != "p.Total" {
+		t.Errorf("Expected UnbindableType error for p.Total, got %v", err)
+	}
+}
@@ -3,9 +3,10 @@ package proteus
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"log/slog"
 	"reflect"
-	"strings"
 
 	"github.com/jonbodner/proteus/mapper"
 )
@@ -13,16 +14,23 @@ import (
 type Builder struct {
 	adapter ParamAdapter
 	mappers []QueryMapper
+	opts    options
 }
 
+// NewBuilder creates a Builder. Any Option values passed in with the QueryMappers apply to every function
+// and query built with the Builder.
 func NewBuilder(adapter ParamAdapter, mappers ...QueryMapper) Builder {
+	queryMappers, opts := splitOptions(options{}, mappers)
 	return Builder{
 		adapter: adapter,
-		mappers: mappers,
+		mappers: queryMappers,
+		opts:    opts,
 	}
 }
 
-func (fb Builder) BuildFunction(ctx context.Context, f any, query string, names []string) error {
+// BuildFunction populates the function pointed to by f. The Options passed in are applied on top of the
+// Options for the Builder.
+func (fb Builder) BuildFunction(ctx context.Context, f any, query string, names []string, opts ...Option) error {
 	// make sure that f is of the right type (pointer to function)
 	funcPointerType := reflect.TypeOf(f)
 	//must be a pointer to func
@@ -58,7 +66,9 @@ func (fb Builder) BuildFunction(ctx context.Context, f any, query string, names
 		return err
 	}
 
-	implementation, err := makeImplementation(ctx, funcType, query, fb.adapter, nameOrderMap)
+	_, funcOpts := splitOptions(fb.opts, nil, opts...)
+	funcOpts.names = names
+	implementation, err := makeImplementation(ctx, funcType, query, dialectFor(fb.adapter, funcOpts), nameOrderMap, funcOpts)
 	if err != nil {
 		return err
 	}
@@ -71,7 +81,7 @@ func (fb Builder) BuildFunction(ctx context.Context, f any, query string, names
 func buildFuncNameOrderMap(names []string, startPos int) map[string]int {
 	out := map[string]int{}
 	for k, v := range names {
-		out[strings.TrimSpace(v)] = k + startPos
+		out[propName(v)] = k + startPos
 	}
 	return out
 }
@@ -82,8 +92,8 @@ func (st sliceTypes) In(i int) reflect.Type {
 	return st[i]
 }
 
-func (fb Builder) Exec(ctx context.Context, e ContextExecutor, query string, params map[string]any) (int64, error) {
-	result, err := fb.ExecResult(ctx, e, query, params)
+func (fb Builder) Exec(ctx context.Context, e ContextExecutor, query string, params map[string]any, opts ...Option) (int64, error) {
+	result, err := fb.ExecResult(ctx, e, query, params, opts...)
 	if err != nil {
 		return 0, err
 	}
@@ -91,47 +101,77 @@ func (fb Builder) Exec(ctx context.Context, e ContextExecutor, query string, par
 	return count, err
 }
 
-func (fb Builder) ExecResult(ctx context.Context, e ContextExecutor, query string, params map[string]any) (sql.Result, error) {
-	finalQuery, queryArgs, err := fb.setupDynamicQueries(ctx, query, params)
+func (fb Builder) ExecResult(ctx context.Context, e ContextExecutor, query string, params map[string]any, opts ...Option) (sql.Result, error) {
+	dq, err := fb.setupDynamicQueries(ctx, query, params, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
-	result, err := e.ExecContext(ctx, finalQuery, queryArgs...)
-	return result, err
+	results, err := runDynamicQuery(ctx, dq, func(finalQuery string, queryArgs []any) (sql.Result, error) {
+		return e.ExecContext(ctx, finalQuery, queryArgs...)
+	})
+	if errors.Is(err, errSkipQuery) {
+		return driver.RowsAffected(0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+	return chunkedResult(results), nil
 }
 
-func (fb Builder) Query(ctx context.Context, q ContextQuerier, query string, params map[string]any, output any) error {
+func (fb Builder) Query(ctx context.Context, q ContextQuerier, query string, params map[string]any, output any, opts ...Option) error {
 	// make sure that output is a pointer to something
 	outputPointerType := reflect.TypeOf(output)
 	if outputPointerType.Kind() != reflect.Pointer {
 		return ValidationError{Kind: NotPointer}
 	}
 
-	finalQuery, queryArgs, err := fb.setupDynamicQueries(ctx, query, params)
-	if err != nil {
-		return err
-	}
+	sType := outputPointerType.Elem()
+	qZero := reflect.Zero(sType)
+	outputValue := reflect.ValueOf(output).Elem()
 
-	slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
-	rows, err := q.QueryContext(ctx, finalQuery, queryArgs...)
+	dq, err := fb.setupDynamicQueries(ctx, query, params, opts)
 	if err != nil {
 		return err
 	}
+	if dq.chunk != nil && sType.Kind() != reflect.Slice {
+		if dq.opts.chunk {
+			return ValidationError{Kind: ChunkedReturnType}
+		}
+		//a batch of rows can't be split if the results can't be combined
+		dq.chunk = nil
+	}
 
-	sType := outputPointerType.Elem()
-	qZero := reflect.Zero(sType)
 	builder, err := mapper.MakeBuilder(ctx, sType)
 	if err != nil {
 		return err
 	}
 
-	val, err := handleMapping(ctx, sType, rows, builder)
+	vals, err := runDynamicQuery(ctx, dq, func(finalQuery string, queryArgs []any) (any, error) {
+		rows, err := q.QueryContext(ctx, finalQuery, queryArgs...)
+		if err != nil {
+			return nil, err
+		}
+		return handleMapping(ctx, sType, rows, builder)
+	})
+	if errors.Is(err, errSkipQuery) {
+		outputValue.Set(qZero)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	outputValue := reflect.ValueOf(output).Elem()
+	val := vals[0]
+	if len(vals) > 1 {
+		s := reflect.MakeSlice(sType, 0, 0)
+		for _, v := range vals {
+			s = reflect.AppendSlice(s, reflect.ValueOf(v))
+		}
+		val = s.Interface()
+	}
 	if val == nil {
 		outputValue.Set(qZero)
 		return nil
@@ -141,7 +181,41 @@ func (fb Builder) Query(ctx context.Context, q ContextQuerier, query string, par
 	return nil
 }
 
-func (fb Builder) setupDynamicQueries(ctx context.Context, query string, paramsAndNames map[string]any) (string, []any, error) {
+// dynamicQuery is an ad-hoc query that has been built and is ready to run.
+type dynamicQuery struct {
+	fixedQuery queryHolder
+	paramOrder []paramInfo
+	args       []reflect.Value
+	opts       options
+	chunk      *chunker
+}
+
+// runDynamicQuery finalizes the query and calls run with it. If the query needs to be split into chunks, run is
+// called once per chunk.
+func runDynamicQuery[T any](ctx context.Context, dq dynamicQuery, run func(string, []any) (T, error)) ([]T, error) {
+	finalQuery, err := dq.fixedQuery.finalize(ctx, dq.args)
+	if err != nil {
+		return nil, err
+	}
+
+	queryArgs, err := buildQueryArgs(ctx, dq.args, dq.paramOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunks := dq.chunk.split(dq.args, len(queryArgs)); len(chunks) > 1 {
+		return runChunks(ctx, dq.fixedQuery, dq.paramOrder, chunks, run)
+	}
+
+	slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
+	result, err := run(finalQuery, queryArgs)
+	if err != nil {
+		return nil, err
+	}
+	return []T{result}, nil
+}
+
+func (fb Builder) setupDynamicQueries(ctx context.Context, query string, paramsAndNames map[string]any, opts []Option) (dynamicQuery, error) {
 	params := make([]any, 0, len(paramsAndNames))
 	names := make([]string, 0, len(paramsAndNames))
 	for k, v := range paramsAndNames {
@@ -154,7 +228,7 @@ func (fb Builder) setupDynamicQueries(ctx context.Context, query string, paramsA
 	//check to see if the query is in a QueryMapper
 	query, err := lookupQuery(query, fb.mappers)
 	if err != nil {
-		return "", nil, err
+		return dynamicQuery{}, err
 	}
 
 	st := make(sliceTypes, 0, len(params))
@@ -164,20 +238,19 @@ func (fb Builder) setupDynamicQueries(ctx context.Context, query string, paramsA
 		args = append(args, reflect.ValueOf(v))
 	}
 
-	fixedQuery, paramOrder, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, st, fb.adapter)
+	_, queryOpts := splitOptions(fb.opts, nil, opts...)
+	dialect := dialectFor(fb.adapter, queryOpts)
+	fixedQuery, paramOrder, err := buildFixedQueryAndParamOrder(ctx, query, nameOrderMap, st, dialect, queryOpts)
 	if err != nil {
-		return "", nil, err
+		return dynamicQuery{}, err
 	}
 
-	finalQuery, err := fixedQuery.finalize(ctx, args)
-	if err != nil {
-		return "", nil, err
+	dq := dynamicQuery{fixedQuery: fixedQuery, paramOrder: paramOrder, args: args, opts: queryOpts}
+	if queryOpts.chunk || hasRows(paramOrder) {
+		dq.chunk, err = newChunker(st, paramOrder, dialect.MaxParams())
+		if err != nil && queryOpts.chunk {
+			return dynamicQuery{}, err
+		}
 	}
-
-	queryArgs, err := buildQueryArgs(ctx, args, paramOrder)
-	if err != nil {
-		return "", nil, err
-	}
-
-	return finalQuery, queryArgs, nil
+	return dq, nil
 }
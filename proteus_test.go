@@ -63,21 +63,21 @@ func TestConvertToPositionalParameters(t *testing.T) {
 			map[string]int{"id": 1},
 			reflect.TypeOf(f1),
 			"select * from Product where id = ?",
-			[]paramInfo{{"id", 1, false}},
+			[]paramInfo{{name: "id", posInParams: 1}},
 			nil,
 		},
 		`update Product set name = :p.Name:, cost = :p.Cost: where id = :p.Id:`: inner{
 			map[string]int{"p": 1},
 			reflect.TypeOf(f2),
 			"update Product set name = ?, cost = ? where id = ?",
-			[]paramInfo{{"p.Name", 1, false}, {"p.Cost", 1, false}, {"p.Id", 1, false}},
+			[]paramInfo{{name: "p.Name", posInParams: 1}, {name: "p.Cost", posInParams: 1}, {name: "p.Id", posInParams: 1}},
 			nil,
 		},
 		`select * from Product where name=:name: and cost=:cost:`: inner{
 			map[string]int{"name": 1, "cost": 2},
 			reflect.TypeOf(f3),
 			"select * from Product where name=? and cost=?",
-			[]paramInfo{{"name", 1, false}, {"cost", 2, false}},
+			[]paramInfo{{name: "name", posInParams: 1}, {name: "cost", posInParams: 2}},
 			nil,
 		},
 		//forget ending :
@@ -88,13 +88,31 @@ func TestConvertToPositionalParameters(t *testing.T) {
 			nil,
 			QueryError{Kind: MissingClosingColon, Query: `select * from Product where name=:name: and cost=:cost`},
 		},
-		//empty ::
+		//:: is a cast, not an empty variable
 		`select * from Product where name=:: and cost=:cost`: inner{
 			map[string]int{"name": 1, "cost": 2},
 			reflect.TypeOf(f3),
 			"",
 			nil,
-			QueryError{Kind: EmptyVariable, Position: 34},
+			QueryError{Kind: MissingClosingColon, Query: `select * from Product where name=:: and cost=:cost`},
+		},
+		//casts, string literals and comments are left alone
+		`select '10:30', id::text from Product where name=:name:::text -- note: cost is :cost:
+and cost=:cost: /* :name: */`: inner{
+			map[string]int{"name": 1, "cost": 2},
+			reflect.TypeOf(f3),
+			`select '10:30', id::text from Product where name=?::text -- note: cost is :cost:
+and cost=? /* :name: */`,
+			[]paramInfo{{name: "name", posInParams: 1}, {name: "cost", posInParams: 2}},
+			nil,
+		},
+		//unterminated string literal
+		`select * from Product where name=':name:`: inner{
+			map[string]int{"name": 1, "cost": 2},
+			reflect.TypeOf(f3),
+			"",
+			nil,
+			QueryError{Kind: UnterminatedLiteral, Query: `select * from Product where name=':name:`, Position: 33},
 		},
 		//invalid identifier
 		`select * from Product where name=:a,b,c: and cost=:cost`: inner{
@@ -109,14 +127,14 @@ func TestConvertToPositionalParameters(t *testing.T) {
 			map[string]int{"name": 1, "cost": 2},
 			reflect.TypeOf(f3),
 			"select * from Pr:oduct where name=? and cost=?",
-			[]paramInfo{{"name", 1, false}, {"cost", 2, false}},
+			[]paramInfo{{name: "name", posInParams: 1}, {name: "cost", posInParams: 2}},
 			nil,
 		},
 	}
 
 	ctx := context.Background()
 	for k, v := range values {
-		q, qps, err := buildFixedQueryAndParamOrder(ctx, k, v.paramMap, v.funcType, MySQL)
+		q, qps, err := buildFixedQueryAndParamOrder(ctx, k, v.paramMap, v.funcType, MySQLDialect, options{})
 		var qSimple string
 		if err == nil {
 			qSimple, _ = q.finalize(ctx, nil)
@@ -191,6 +209,14 @@ func TestValidateFunction(t *testing.T) {
 	var f3 func(Executor, chan int)
 	f(reflect.TypeOf(f3), ValidationError{Kind: ChannelInputParam})
 
+	//invalid -- has a variadic channel input param
+	var f4 func(Executor, ...chan int)
+	f(reflect.TypeOf(f4), ValidationError{Kind: ChannelInputParam})
+
+	//valid -- a variadic input param
+	var g0 func(Executor, string, ...int)
+	fOk(reflect.TypeOf(g0), true)
+
 	//valid -- only an Executor
 	var g1 func(Executor)
 	fOk(reflect.TypeOf(g1), true)
@@ -1,6 +1,7 @@
 package proteus
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"testing"
@@ -105,3 +106,55 @@ func runMapper(m QueryMapper, t *testing.T) {
 		t.Errorf("Expected no error, got %v", err)
 	}
 }
+
+func TestIncludes(t *testing.T) {
+	m := MapMapper{
+		"columns":  "id, name, {{>cost}}",
+		"cost":     "cost",
+		"byId":     "select {{> columns }} from product where id = :id:",
+		"loopA":    "select {{>loopB}}",
+		"loopB":    "{{> loopA}}",
+		"missing":  "select {{> nope}} from product",
+		"selfLoop": "select {{>selfLoop}}",
+	}
+	data := []struct {
+		name  string
+		query string
+		want  string
+		err   error
+	}{
+		{"nested", "q:byId", "select id, name, cost from product where id = :id:", nil},
+		{"inline", "select {{>columns}} from product", "select id, name, cost from product", nil},
+		{"cycle", "q:loopA", "", QueryError{Kind: IncludeCycle, Name: "loopA -> loopB -> loopA"}},
+		{"self", "q:selfLoop", "", QueryError{Kind: IncludeCycle, Name: "selfLoop -> selfLoop"}},
+		{"missing", "q:missing", "", QueryError{Kind: IncludeNotFound, Name: "nope"}},
+	}
+	for _, v := range data {
+		t.Run(v.name, func(t *testing.T) {
+			got, err := lookupQuery(v.query, []QueryMapper{m})
+			if err != v.err {
+				t.Errorf("expected error %v, got %v", v.err, err)
+			}
+			if got != v.want {
+				t.Errorf("expected %q, got %q", v.want, got)
+			}
+		})
+	}
+
+	type s struct {
+		GetF func(q Querier, id string) (map[string]any, error) `proq:"q:byId" prop:"id"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(context.Background(), &sImpl, Postgres, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dummyDB := &DummyDB{
+		Queries: []string{"select id, name, cost from product where id = $1"},
+		Args:    [][]any{{"1"}},
+	}
+	_, err = sImpl.GetF(dummyDB, "1")
+	if _, ok := err.(NoErrType); !ok {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -2,35 +2,79 @@ package proteus
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"reflect"
 	"strings"
 
 	"database/sql"
+	"database/sql/driver"
 
 	"github.com/jonbodner/proteus/mapper"
 )
 
 func buildQueryArgs(ctx context.Context, funcArgs []reflect.Value, paramOrder []paramInfo) ([]any, error) {
 
+	present, err := fragmentsPresent(ctx, funcArgs, paramOrder)
+	if err != nil {
+		return nil, err
+	}
+
 	//walk through the rest of the input parameters and build a slice for args
 	var out []any
 	for _, v := range paramOrder {
-		value := funcArgs[v.posInParams]
-		var realValue any
-		if value.IsValid() {
-			realValue = value.Interface()
+		if v.reused || v.identifier || v.sortColumns != nil || !included(v, present) {
+			continue
+		}
+		val, err := extractParam(ctx, funcArgs, v)
+		if err != nil {
+			return nil, err
 		}
-		val, err := mapper.Extract(ctx, realValue, strings.Split(v.name, "."))
+		val, err = applyTransforms(val, v)
 		if err != nil {
 			return nil, err
 		}
-		if v.isSlice {
+		switch {
+		case len(v.columns) > 0:
+			rows, err := buildRowsArgs(ctx, val, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, rows...)
+		case v.filterColumns != nil:
+			values, err := filterValue(val, v).args()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, values...)
+		case v.cursor:
+			values, err := cursorArgs(val, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, values...)
+		case v.page:
+			values, err := pageValues(val, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, values...)
+		case v.isSlice || (v.runtimeSlice && isExpandedSlice(reflect.TypeOf(val))):
 			curSlice := reflect.ValueOf(val)
-			for i := 0; i < curSlice.Len(); i++ {
+			if sliceLen(val) == 0 {
+				switch v.empty {
+				case EmptySliceSkip:
+					return nil, errSkipQuery
+				case EmptySliceError:
+					return nil, QueryError{Kind: EmptySlice, Name: v.name}
+				}
+			}
+			for i := 0; i < sliceLen(val); i++ {
 				out = append(out, curSlice.Index(i).Interface())
 			}
-		} else {
+		case v.asArray:
+			out = append(out, arrayValue(val))
+		default:
 			out = append(out, val)
 		}
 	}
@@ -38,6 +82,47 @@ func buildQueryArgs(ctx context.Context, funcArgs []reflect.Value, paramOrder []
 	return out, nil
 }
 
+// buildRowsArgs returns the values for each column of each element in a batch of rows.
+func buildRowsArgs(ctx context.Context, val any, v paramInfo) ([]any, error) {
+	curSlice := reflect.ValueOf(val)
+	if curSlice.Len() == 0 {
+		//there's no way to write an empty batch, so it's skipped unless it's an error
+		if v.empty == EmptySliceError {
+			return nil, QueryError{Kind: EmptySlice, Name: v.name}
+		}
+		return nil, errSkipQuery
+	}
+	paths := make([][]string, len(v.columns))
+	for i, c := range v.columns {
+		paths[i] = strings.Split(c, ".")
+	}
+	out := make([]any, 0, curSlice.Len()*len(paths))
+	for i := 0; i < curSlice.Len(); i++ {
+		elem := curSlice.Index(i).Interface()
+		for _, path := range paths {
+			colVal, err := mapper.Extract(ctx, elem, path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, colVal)
+		}
+	}
+	return out, nil
+}
+
+// errSkipQuery is returned by buildQueryArgs when an empty slice means that the database shouldn't be called.
+// The functions that build return values treat it as a successful call with no results.
+var errSkipQuery = errors.New("query skipped for empty slice")
+
+// arrayValue wraps a slice so that it can be bound to a single parameter as a Postgres array, unless it already
+// knows how to convert itself.
+func arrayValue(val any) any {
+	if _, ok := val.(driver.Valuer); ok {
+		return val
+	}
+	return pgArray{val: val}
+}
+
 var (
 	errZero       = reflect.Zero(errType)
 	zeroInt64     = reflect.Zero(reflect.TypeFor[int64]())
@@ -45,7 +130,7 @@ var (
 	sqlResultType = reflect.TypeFor[sql.Result]()
 )
 
-func makeContextExecutorImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo) func(args []reflect.Value) []reflect.Value {
+func makeContextExecutorImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo, chunk *chunker) func(args []reflect.Value) []reflect.Value {
 	buildRetVals := makeExecutorReturnVals(funcType)
 	return func(args []reflect.Value) []reflect.Value {
 
@@ -65,6 +150,16 @@ func makeContextExecutorImplementation(ctx context.Context, funcType reflect.Typ
 			return buildRetVals(result, err)
 		}
 
+		if chunks := chunk.split(args, len(queryArgs)); len(chunks) > 1 {
+			results, err := runChunks(ctx, query, paramOrder, chunks, func(finalQuery string, queryArgs []any) (sql.Result, error) {
+				return executor.ExecContext(ctx, finalQuery, queryArgs...)
+			})
+			if err != nil {
+				return buildRetVals(nil, err)
+			}
+			return buildRetVals(chunkedResult(results), nil)
+		}
+
 		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
 		result, err = executor.ExecContext(ctx, finalQuery, queryArgs...)
 
@@ -72,7 +167,7 @@ func makeContextExecutorImplementation(ctx context.Context, funcType reflect.Typ
 	}
 }
 
-func makeExecutorImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo) func(args []reflect.Value) []reflect.Value {
+func makeExecutorImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo, chunk *chunker) func(args []reflect.Value) []reflect.Value {
 	buildRetVals := makeExecutorReturnVals(funcType)
 	return func(args []reflect.Value) []reflect.Value {
 
@@ -91,6 +186,16 @@ func makeExecutorImplementation(ctx context.Context, funcType reflect.Type, quer
 			return buildRetVals(result, err)
 		}
 
+		if chunks := chunk.split(args, len(queryArgs)); len(chunks) > 1 {
+			results, err := runChunks(ctx, query, paramOrder, chunks, func(finalQuery string, queryArgs []any) (sql.Result, error) {
+				return executor.Exec(finalQuery, queryArgs...)
+			})
+			if err != nil {
+				return buildRetVals(nil, err)
+			}
+			return buildRetVals(chunkedResult(results), nil)
+		}
+
 		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
 		result, err = executor.Exec(finalQuery, queryArgs...)
 
@@ -99,6 +204,16 @@ func makeExecutorImplementation(ctx context.Context, funcType reflect.Type, quer
 }
 
 func makeExecutorReturnVals(funcType reflect.Type) func(sql.Result, error) []reflect.Value {
+	buildRetVals := makeExecutorResultReturnVals(funcType)
+	return func(result sql.Result, err error) []reflect.Value {
+		if errors.Is(err, errSkipQuery) {
+			return buildRetVals(driver.RowsAffected(0), nil)
+		}
+		return buildRetVals(result, err)
+	}
+}
+
+func makeExecutorResultReturnVals(funcType reflect.Type) func(sql.Result, error) []reflect.Value {
 	numOut := funcType.NumOut()
 
 	//handle the 0,1,2 out parameter cases
@@ -157,7 +272,7 @@ func makeExecutorReturnVals(funcType reflect.Type) func(sql.Result, error) []ref
 	}
 }
 
-func makeContextQuerierImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo) (func(args []reflect.Value) []reflect.Value, error) {
+func makeContextQuerierImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo, chunk *chunker) (func(args []reflect.Value) []reflect.Value, error) {
 	numOut := funcType.NumOut()
 	var builder mapper.Builder
 	var err error
@@ -168,6 +283,10 @@ func makeContextQuerierImplementation(ctx context.Context, funcType reflect.Type
 		}
 	}
 	buildRetVals := makeQuerierReturnVals(ctx, funcType, builder)
+	mapChunk, buildChunkRetVals, err := makeChunkedQuerierReturnVals(ctx, funcType, builder, chunk)
+	if err != nil {
+		return nil, err
+	}
 	return func(args []reflect.Value) []reflect.Value {
 		querier := args[1].Interface().(ContextQuerier)
 		ctx := args[0].Interface().(context.Context)
@@ -183,6 +302,17 @@ func makeContextQuerierImplementation(ctx context.Context, funcType reflect.Type
 			return buildRetVals(rows, err)
 		}
 
+		if chunks := chunk.split(args, len(queryArgs)); len(chunks) > 1 {
+			vals, err := runChunks(ctx, query, paramOrder, chunks, func(finalQuery string, queryArgs []any) (any, error) {
+				rows, err := querier.QueryContext(ctx, finalQuery, queryArgs...)
+				if err != nil {
+					return nil, err
+				}
+				return mapChunk(rows)
+			})
+			return buildChunkRetVals(vals, err)
+		}
+
 		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
 		// going to work around the defective Go MySQL driver, which refuses to convert the text protocol properly.
 		// It is used when doing a query without parameters.
@@ -206,7 +336,7 @@ func makeContextQuerierImplementation(ctx context.Context, funcType reflect.Type
 	}, nil
 }
 
-func makeQuerierImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo) (func(args []reflect.Value) []reflect.Value, error) {
+func makeQuerierImplementation(ctx context.Context, funcType reflect.Type, query queryHolder, paramOrder []paramInfo, chunk *chunker) (func(args []reflect.Value) []reflect.Value, error) {
 	numOut := funcType.NumOut()
 	var builder mapper.Builder
 	var err error
@@ -217,6 +347,10 @@ func makeQuerierImplementation(ctx context.Context, funcType reflect.Type, query
 		}
 	}
 	buildRetVals := makeQuerierReturnVals(ctx, funcType, builder)
+	mapChunk, buildChunkRetVals, err := makeChunkedQuerierReturnVals(ctx, funcType, builder, chunk)
+	if err != nil {
+		return nil, err
+	}
 	return func(args []reflect.Value) []reflect.Value {
 		querier := args[0].Interface().(Querier)
 
@@ -231,6 +365,17 @@ func makeQuerierImplementation(ctx context.Context, funcType reflect.Type, query
 			return buildRetVals(rows, err)
 		}
 
+		if chunks := chunk.split(args, len(queryArgs)); len(chunks) > 1 {
+			vals, err := runChunks(ctx, query, paramOrder, chunks, func(finalQuery string, queryArgs []any) (any, error) {
+				rows, err := querier.Query(finalQuery, queryArgs...)
+				if err != nil {
+					return nil, err
+				}
+				return mapChunk(rows)
+			})
+			return buildChunkRetVals(vals, err)
+		}
+
 		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs)
 		// going to work around the defective Go MySQL driver, which refuses to convert the text protocol properly.
 		// It is used when doing a query without parameters.
@@ -255,11 +400,35 @@ func makeQuerierImplementation(ctx context.Context, funcType reflect.Type, query
 }
 
 func makeQuerierReturnVals(ctx context.Context, funcType reflect.Type, builder mapper.Builder) func(*sql.Rows, error) []reflect.Value {
+	//handle the 0 out parameter case
+	if funcType.NumOut() == 0 {
+		return func(*sql.Rows, error) []reflect.Value {
+			return []reflect.Value{}
+		}
+	}
+
+	sType := funcType.Out(0)
+	buildRetVals := makeQuerierValueReturnVals(funcType)
+	return func(rows *sql.Rows, err error) []reflect.Value {
+		if errors.Is(err, errSkipQuery) {
+			return buildRetVals(nil, nil)
+		}
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		// handle mapping
+		val, err := handleMapping(ctx, sType, rows, builder)
+		return buildRetVals(val, err)
+	}
+}
+
+// makeQuerierValueReturnVals returns a function that converts the mapped result of a query into the return values.
+func makeQuerierValueReturnVals(funcType reflect.Type) func(any, error) []reflect.Value {
 	numOut := funcType.NumOut()
 
 	//handle the 0,1,2 out parameter cases
 	if numOut == 0 {
-		return func(*sql.Rows, error) []reflect.Value {
+		return func(any, error) []reflect.Value {
 			return []reflect.Value{}
 		}
 	}
@@ -267,29 +436,16 @@ func makeQuerierReturnVals(ctx context.Context, funcType reflect.Type, builder m
 	sType := funcType.Out(0)
 	qZero := reflect.Zero(sType)
 	if numOut == 1 {
-		return func(rows *sql.Rows, err error) []reflect.Value {
-			if err != nil {
-				return []reflect.Value{qZero}
-			}
-			// handle mapping
-			val, err := handleMapping(ctx, sType, rows, builder)
-			if err != nil {
-				return []reflect.Value{qZero}
-			}
-			if val == nil {
+		return func(val any, err error) []reflect.Value {
+			if err != nil || val == nil {
 				return []reflect.Value{qZero}
 			}
 			return []reflect.Value{reflect.ValueOf(val).Convert(sType)}
 		}
 	}
 	if numOut == 2 {
-		return func(rows *sql.Rows, err error) []reflect.Value {
+		return func(val any, err error) []reflect.Value {
 			eType := funcType.Out(1)
-			if err != nil {
-				return []reflect.Value{qZero, reflect.ValueOf(err).Convert(eType)}
-			}
-			// handle mapping
-			val, err := handleMapping(ctx, sType, rows, builder)
 			var eVal reflect.Value
 			if err == nil {
 				eVal = errZero
@@ -304,11 +460,68 @@ func makeQuerierReturnVals(ctx context.Context, funcType reflect.Type, builder m
 	}
 
 	// impossible case since validation should happen first, but be safe
-	return func(*sql.Rows, error) []reflect.Value {
+	return func(any, error) []reflect.Value {
 		return []reflect.Value{qZero, reflect.ValueOf(ValidationError{Kind: ShouldNeverGetHere})}
 	}
 }
 
+// makeChunkedQuerierReturnVals returns a function that maps the rows returned for a single chunk, and a function that
+// concatenates the mapped chunks into the return values. Chunked queries must return a slice (or nothing), since
+// there's no way to combine the results otherwise.
+func makeChunkedQuerierReturnVals(ctx context.Context, funcType reflect.Type, builder mapper.Builder, chunk *chunker) (func(*sql.Rows) (any, error), func([]any, error) []reflect.Value, error) {
+	if chunk == nil {
+		return nil, nil, nil
+	}
+	buildRetVals := makeQuerierValueReturnVals(funcType)
+	if funcType.NumOut() == 0 {
+		mapChunk := func(rows *sql.Rows) (any, error) {
+			return nil, rows.Close()
+		}
+		return mapChunk, func(_ []any, err error) []reflect.Value {
+			return buildRetVals(nil, err)
+		}, nil
+	}
+	sType := funcType.Out(0)
+	if sType.Kind() != reflect.Slice {
+		return nil, nil, ValidationError{Kind: ChunkedReturnType}
+	}
+	mapChunk := func(rows *sql.Rows) (any, error) {
+		return handleMapping(ctx, sType, rows, builder)
+	}
+	return mapChunk, func(vals []any, err error) []reflect.Value {
+		if err != nil {
+			return buildRetVals(nil, err)
+		}
+		s := reflect.MakeSlice(sType, 0, 0)
+		for _, v := range vals {
+			s = reflect.AppendSlice(s, reflect.ValueOf(v))
+		}
+		return buildRetVals(s.Interface(), nil)
+	}, nil
+}
+
+// runChunks runs the query once for each set of args returned by chunker.split, stopping at the first error.
+func runChunks[T any](ctx context.Context, query queryHolder, paramOrder []paramInfo, chunks [][]reflect.Value, run func(string, []any) (T, error)) ([]T, error) {
+	out := make([]T, 0, len(chunks))
+	for i, chunkArgs := range chunks {
+		finalQuery, err := query.finalize(ctx, chunkArgs)
+		if err != nil {
+			return nil, err
+		}
+		queryArgs, err := buildQueryArgs(ctx, chunkArgs, paramOrder)
+		if err != nil {
+			return nil, err
+		}
+		slog.DebugContext(ctx, "calling query", "query", finalQuery, "params", queryArgs, "chunk", i+1, "chunks", len(chunks))
+		result, err := run(finalQuery, queryArgs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, result)
+	}
+	return out, nil
+}
+
 func handleMapping(ctx context.Context, sType reflect.Type, rows *sql.Rows, builder mapper.Builder) (any, error) {
 	if rows == nil {
 		return nil, ValidationError{Kind: RowsMustBeNonNil}
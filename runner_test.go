@@ -51,7 +51,7 @@ func Test_buildExec(t *testing.T) {
 	}
 	ctx := context.Background()
 	for _, tt := range tests {
-		got := makeExecutorImplementation(ctx, tt.args.funcType, tt.args.positionalQuery, tt.args.qps)
+		got := makeExecutorImplementation(ctx, tt.args.funcType, tt.args.positionalQuery, tt.args.qps, nil)
 		if !reflect.DeepEqual(got, tt.want) {
 			t.Errorf("%q. makeExecutorImplementation() = %T, want %T", tt.name, got, tt.want)
 		}
@@ -74,7 +74,7 @@ func Test_buildQuery(t *testing.T) {
 	}
 	ctx := context.Background()
 	for _, tt := range tests {
-		got, err := makeQuerierImplementation(ctx, tt.args.funcType, tt.args.positionalQuery, tt.args.qps)
+		got, err := makeQuerierImplementation(ctx, tt.args.funcType, tt.args.positionalQuery, tt.args.qps, nil)
 		if (err != nil) != tt.wantErr {
 			t.Errorf("%q. makeQuerierImplementation() error = %v, wantErr %v", tt.name, err, tt.wantErr)
 			continue
@@ -0,0 +1,77 @@
+package proteus
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// Sort is a parameter type that lists the keys that the rows returned by a query are sorted by, in order. A query
+// refers to a Sort like any other variable, as in order by :sort:. Each key is replaced with the column expression
+// that it maps to, declared with WithSortColumns or the prosort struct tag, so the client chooses the sort order
+// without ever writing SQL. A key without a mapping is rejected with a QueryError before the query is run.
+type Sort []SortKey
+
+// SortKey is a single key in a Sort.
+type SortKey struct {
+	Key  string
+	Desc bool
+}
+
+// ParseSort converts a comma-separated list of keys, like "name,-cost", into a Sort. A key that starts with a - is
+// sorted in descending order.
+func ParseSort(s string) Sort {
+	var out Sort
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		key, desc := strings.CutPrefix(v, "-")
+		out = append(out, SortKey{Key: key, Desc: desc})
+	}
+	return out
+}
+
+var sortType = reflect.TypeFor[Sort]()
+
+// buildSortParamInfo makes sure that a Sort variable has columns that its keys map to.
+func buildSortParamInfo(id string, paramPos int, opts options) (paramInfo, error) {
+	if len(opts.sortColumns) == 0 {
+		return paramInfo{}, QueryError{Kind: NoSortColumns, Name: id}
+	}
+	return paramInfo{name: id, posInParams: paramPos, sortColumns: opts.sortColumns}, nil
+}
+
+// sortValue writes out the column expressions for the keys in a Sort, like name ASC, cost DESC.
+func sortValue(ctx context.Context, args []reflect.Value, v paramInfo) (string, error) {
+	val, err := extractParam(ctx, args, v)
+	if err != nil {
+		return "", err
+	}
+	var sort Sort
+	if rv := reflect.Indirect(reflect.ValueOf(val)); rv.IsValid() {
+		sort = rv.Interface().(Sort)
+	}
+	if len(sort) == 0 {
+		//there's nothing valid to write after order by; wrap it in [[ ]] to leave it out instead
+		return "", QueryError{Kind: EmptySlice, Name: v.name}
+	}
+	var b strings.Builder
+	for i, k := range sort {
+		column, ok := v.sortColumns[k.Key]
+		if !ok {
+			return "", QueryError{Kind: UnknownSortKey, Name: v.name, Value: k.Key}
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(column)
+		if k.Desc {
+			b.WriteString(" DESC")
+		} else {
+			b.WriteString(" ASC")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,94 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSort(t *testing.T) {
+	expected := Sort{{Key: "name"}, {Key: "cost", Desc: true}}
+	if diff := cmp.Diff(expected, ParseSort(" name, -cost,")); diff != "" {
+		t.Error(diff)
+	}
+	if s := ParseSort(""); s != nil {
+		t.Errorf("expected nil, got %v", s)
+	}
+}
+
+func TestSort(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		List   func(ctx context.Context, e ContextExecutor, name string, sort Sort) (int64, error) `proq:"update foo set a = 1 where name = :name: order by :sort:" prop:"name,sort" prosort:"name=f.name,newest=f.created_at"`
+		Search func(ctx context.Context, e ContextExecutor, p struct{ Sort *Sort }) (int64, error) `proq:"update foo set a = 1[[ order by :p.Sort:]]" prop:"p"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(ctx, &sImpl, Postgres, WithSortColumns(map[string]string{"cost": "lower(f.cost)"}))
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	if _, err = sImpl.List(ctx, re, "bob", Sort{{Key: "newest", Desc: true}, {Key: "name"}, {Key: "cost"}}); err != nil {
+		t.Fatal(err)
+	}
+	sort := ParseSort("-cost")
+	if _, err = sImpl.Search(ctx, re, struct{ Sort *Sort }{&sort}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.Search(ctx, re, struct{ Sort *Sort }{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"update foo set a = 1 where name = $1 order by f.created_at DESC, f.name ASC, lower(f.cost) ASC",
+		"update foo set a = 1 order by lower(f.cost) DESC",
+		"update foo set a = 1",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"bob"}, nil, nil}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// bad sorts never reach the database
+	re = &recordingExecutor{}
+	_, err = sImpl.List(ctx, re, "bob", ParseSort("name,password"))
+	if !errors.Is(err, QueryError{Kind: UnknownSortKey}) {
+		t.Errorf("Expected UnknownSortKey error, got %v", err)
+	}
+	_, err = sImpl.List(ctx, re, "bob", nil)
+	if !errors.Is(err, QueryError{Kind: EmptySlice}) {
+		t.Errorf("Expected EmptySlice error, got %v", err)
+	}
+	if len(re.Queries) != 0 {
+		t.Errorf("Expected no queries, got %v", re.Queries)
+	}
+
+	type noColumns struct {
+		F func(ctx context.Context, e ContextExecutor, sort Sort) (int64, error) `proq:"update foo set a = 1 order by :sort:" prop:"sort"`
+	}
+	err = ShouldBuild(ctx, &noColumns{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: NoSortColumns}) {
+		t.Errorf("Expected NoSortColumns error, got %v", err)
+	}
+	type badTag struct {
+		F func(ctx context.Context, e ContextExecutor, sort Sort) (int64, error) `proq:"update foo set a = 1 order by :sort:" prop:"sort" prosort:"name"`
+	}
+	err = ShouldBuild(ctx, &badTag{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: InvalidColumns}) {
+		t.Errorf("Expected InvalidColumns error, got %v", err)
+	}
+
+	// ad-hoc queries use the columns declared on the Builder or passed with the call
+	b := NewBuilder(MySQL, WithSortColumns(map[string]string{"name": "name"}))
+	re = &recordingExecutor{}
+	_, err = b.Exec(ctx, re, "update foo set a = :a: order by :sort:", map[string]any{"a": 1, "sort": ParseSort("-name,id")}, WithSortColumns(map[string]string{"id": "id"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"update foo set a = ? order by name DESC, id ASC"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+}
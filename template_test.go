@@ -11,7 +11,7 @@ func TestTemplate(t *testing.T) {
 	tpl := addSlice("vals")
 
 	funcMap := template.FuncMap{
-		"join": joinFactory(1, Postgres),
+		"join": joinFactory(1, PostgresDialect),
 	}
 
 	tmpl, err := template.New("template_test").Funcs(funcMap).Parse(tpl)
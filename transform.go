@@ -0,0 +1,140 @@
+package proteus
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Transform converts the value of a variable before it is bound as a parameter. Transforms are listed after the name
+// of a variable, separated by |, as in :name|lower:, and are applied from left to right. A nil value (including a
+// nil pointer) is passed to a Transform like any other value.
+//
+// The built-in transforms are:
+//   - lower and upper, which change the case of a string
+//   - trim, which removes leading and trailing white space from a string
+//   - like, which escapes the %, _, and \ in a string with a \ and wraps it in %, so that it can be used with LIKE to
+//     find the rows that contain it. Postgres and MySQL use \ as the escape character for LIKE by default. SQLite,
+//     SQL Server, and Oracle have no default, so the query must follow the variable with ESCAPE '\', which is written
+//     as ESCAPE '\\' since Proteus reads a \ in a query as an escape.
+//   - json, which converts any value into a JSON string, leaving a nil map or slice as NULL
+//   - utc, which converts a time.Time into UTC
+//
+// Other transforms are registered with WithTransform.
+type Transform func(val any) (any, error)
+
+// errTransformType is returned by a built-in transform when it can't be applied to the type of a value.
+var errTransformType = errors.New("transform can't be applied to this type")
+
+var builtinTransforms = map[string]Transform{
+	"lower": stringTransform(strings.ToLower),
+	"upper": stringTransform(strings.ToUpper),
+	"trim":  stringTransform(strings.TrimSpace),
+	"like": stringTransform(func(s string) string {
+		return "%" + likeEscaper.Replace(s) + "%"
+	}),
+	"json": func(val any) (any, error) {
+		if isNil(val) {
+			return nil, nil
+		}
+		out, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		return string(out), nil
+	},
+	"utc": func(val any) (any, error) {
+		if isNil(val) {
+			return nil, nil
+		}
+		t, ok := reflect.Indirect(reflect.ValueOf(val)).Interface().(time.Time)
+		if !ok {
+			return nil, errTransformType
+		}
+		return t.UTC(), nil
+	},
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// stringTransform makes a Transform out of a function that changes a string. It works with any type whose
+// underlying type is string, or a pointer to one.
+func stringTransform(f func(string) string) Transform {
+	return func(val any) (any, error) {
+		if isNil(val) {
+			return nil, nil
+		}
+		rv := reflect.Indirect(reflect.ValueOf(val))
+		if rv.Kind() != reflect.String {
+			return nil, errTransformType
+		}
+		return f(rv.String()), nil
+	}
+}
+
+// isNil reports whether a value is nil, including a nil pointer, map, or slice.
+func isNil(val any) bool {
+	if val == nil {
+		return true
+	}
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// namedTransform is a Transform along with the name it was listed with in the query.
+type namedTransform struct {
+	name string
+	f    Transform
+}
+
+// parseTransforms splits the transforms off of the body of a variable, like name|lower|like. Transforms registered
+// with WithTransform are found before the built-in ones.
+func parseTransforms(value string, opts options) (string, []namedTransform, error) {
+	parts := strings.Split(value, "|")
+	var out []namedTransform
+	for _, v := range parts[1:] {
+		name := strings.TrimSpace(v)
+		f, ok := opts.transforms[name]
+		if !ok {
+			f, ok = builtinTransforms[name]
+		}
+		if !ok {
+			return "", nil, QueryError{Kind: UnknownTransform, Name: strings.TrimSpace(parts[0]), Value: name}
+		}
+		out = append(out, namedTransform{name: name, f: f})
+	}
+	return strings.TrimSpace(parts[0]), out, nil
+}
+
+// transformsKey is the key for the placeholder of a variable with transforms, so that it isn't shared with the same
+// variable without them, or with different ones.
+func transformsKey(id string, transforms []namedTransform) string {
+	var b strings.Builder
+	b.WriteString(id)
+	for _, t := range transforms {
+		b.WriteString("|")
+		b.WriteString(t.name)
+	}
+	return b.String()
+}
+
+// applyTransforms runs the value of a variable through its transforms.
+func applyTransforms(val any, v paramInfo) (any, error) {
+	for _, t := range v.transforms {
+		out, err := t.f(val)
+		if errors.Is(err, errTransformType) {
+			return nil, QueryError{Kind: InvalidTransformType, Name: v.name, Value: t.name, TypeKind: reflect.ValueOf(val).Kind().String()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		val = out
+	}
+	return val, nil
+}
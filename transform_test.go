@@ -0,0 +1,139 @@
+package proteus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransforms(t *testing.T) {
+	ctx := context.Background()
+	type s struct {
+		Update func(ctx context.Context, e ContextExecutor, name string, term *string, doc map[string]int, ts time.Time) (int64, error) `proq:"update foo set name = :name|trim|lower:, doc = :doc|json:, ts = :ts|utc: where descr like :term|like: or name = :name:" prop:"name,term,doc,ts"`
+	}
+	sImpl := s{}
+	err := ShouldBuild(ctx, &sImpl, Postgres)
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	re := &recordingExecutor{}
+	term := `50%_off\`
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+	if _, err = sImpl.Update(ctx, re, " Bob ", &term, map[string]int{"a": 1}, ts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sImpl.Update(ctx, re, "bob", nil, nil, ts); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"update foo set name = $1, doc = $2, ts = $3 where descr like $4 or name = $5",
+		"update foo set name = $1, doc = $2, ts = $3 where descr like $4 or name = $5",
+	}
+	if diff := cmp.Diff(expected, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	utc := time.Date(2024, 1, 2, 8, 4, 5, 0, time.UTC)
+	expectedArgs := [][]any{
+		{"bob", `{"a":1}`, utc, `%50\%\_off\\%`, " Bob "},
+		{"bob", nil, utc, nil, "bob"},
+	}
+	if diff := cmp.Diff(expectedArgs, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// custom transforms; a slice with transforms is a single value, so it is never expanded, even when it is empty
+	type custom struct {
+		Slug func(ctx context.Context, e ContextExecutor, title string, tags []string) (int64, error) `proq:"update foo set slug = #{title | slug}, tags = #{tags|json} where title = #{title}" prop:"title,tags" proopt:"empty=error"`
+	}
+	c := custom{}
+	err = ShouldBuild(ctx, &c, MySQL, WithParamSyntax(HashBraced), WithTransform("slug", func(val any) (any, error) {
+		return strings.ReplaceAll(strings.ToLower(val.(string)), " ", "-"), nil
+	}))
+	if err != nil {
+		t.Fatal("error while building", err)
+	}
+	re = &recordingExecutor{}
+	if _, err = c.Slug(ctx, re, "Hello World", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Slug(ctx, re, "Hello World", nil); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"update foo set slug = ?, tags = ? where title = ?", "update foo set slug = ?, tags = ? where title = ?"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{"hello-world", `["a","b"]`, "Hello World"}, {"hello-world", nil, "Hello World"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// SQLite has no default escape character for LIKE, so the query names it
+	var search func(ctx context.Context, e ContextExecutor, term string) (int64, error)
+	if err = NewBuilder(Sqlite).BuildFunction(ctx, &search, `delete from foo where name like :term|like: escape '\\'`, []string{"term"}); err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = search(ctx, re, "50%_off"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{`delete from foo where name like ? escape '\'`}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{`%50\%\_off%`}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	// the same slice can be expanded in one place and bound as a single value after a transform in another
+	var f func(ctx context.Context, e ContextExecutor, ids []int) (int64, error)
+	if err = NewBuilder(MySQL).BuildFunction(ctx, &f, "update foo set a = 1 where id in (:ids:) and tags = :ids|json:", []string{"ids"}); err != nil {
+		t.Fatal(err)
+	}
+	re = &recordingExecutor{}
+	if _, err = f(ctx, re, []int{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"update foo set a = 1 where id in (?, ?, ?) and tags = ?"}, re.Queries); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]any{{1, 2, 3, "[1,2,3]"}}, re.Args); diff != "" {
+		t.Error(diff)
+	}
+
+	type wrongType struct {
+		F func(ctx context.Context, e ContextExecutor, id int) (int64, error) `proq:"update foo set a = 1 where id = :id|lower:" prop:"id"`
+	}
+	wt := wrongType{}
+	if err = ShouldBuild(ctx, &wt, Postgres); err != nil {
+		t.Fatal(err)
+	}
+	_, err = wt.F(ctx, re, 1)
+	var qe QueryError
+	if !errors.As(err, &qe) || qe.Kind != InvalidTransformType || qe.Value != "lower" || qe.TypeKind != "int" {
+		t.Errorf("Expected InvalidTransformType error, got %v", err)
+	}
+
+	type unknown struct {
+		F func(ctx context.Context, e ContextExecutor, name string) (int64, error) `proq:"update foo set a = 1 where name = :name|lowercase:" prop:"name"`
+	}
+	err = ShouldBuild(ctx, &unknown{}, Postgres)
+	if !errors.As(err, &qe) || qe.Kind != UnknownTransform || qe.Name != "name" || qe.Value != "lowercase" {
+		t.Errorf("Expected UnknownTransform error, got %v", err)
+	}
+	type notAllowed struct {
+		F func(ctx context.Context, e ContextExecutor, sort Sort) (int64, error) `proq:"update foo set a = 1 order by :sort|lower:" prop:"sort" prosort:"name=name"`
+	}
+	err = ShouldBuild(ctx, &notAllowed{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: TransformNotAllowed}) {
+		t.Errorf("Expected TransformNotAllowed error, got %v", err)
+	}
+	type identifier struct {
+		F func(ctx context.Context, e ContextExecutor, table string) (int64, error) `proq:"update :#table|lower: set a = 1" prop:"table" proid:"table=foo"`
+	}
+	err = ShouldBuild(ctx, &identifier{}, Postgres)
+	if !errors.Is(err, QueryError{Kind: TransformNotAllowed}) {
+		t.Errorf("Expected TransformNotAllowed error, got %v", err)
+	}
+}